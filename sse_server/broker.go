@@ -0,0 +1,389 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is disconnected.
+const subscriberBuffer = 64
+
+// Replay limits used by newBroker.
+const (
+	defaultReplayEvents = 1000
+	defaultReplayAge    = 5 * time.Minute
+)
+
+// broker fans events out to the subscribers of their topic and keeps a
+// bounded history per topic so reconnecting clients can catch up.
+//
+// Every published event gets the next number of a broker-wide sequence, so
+// IDs grow monotonically within a topic and a single Last-Event-ID describes
+// a client's position across all its topics. IDs have the form
+// "<epoch>-<seq>": the epoch changes whenever the process starts, so an ID
+// from before a restart is recognised and answered with a reset instead of
+// being mistaken for a position in the new sequence.
+//
+// One lock orders publishing and subscribing; subscribers therefore see IDs
+// in increasing order and a subscription starts exactly where its replay
+// ends. Publishing never waits for a subscriber: one whose buffer is full is
+// evicted, its Done channel closes and the handler ends the stream, so the
+// client reconnects and replays what it missed.
+//
+// History is trimmed whenever a topic is published to or replayed, and by
+// sweep, which has to be called periodically so idle topics age out too.
+// Topics without subscribers and history are forgotten; a client that may
+// have missed events of a forgotten topic gets a reset for it.
+type broker struct {
+	replayEvents int
+	replayAge    time.Duration
+	now          func() time.Time
+	epoch        string
+
+	mu     sync.Mutex
+	seq    uint64
+	topics map[string]*topic
+	// forgotten is the highest ID dropped together with a deleted topic. A
+	// client behind it may have missed events of any topic the broker no
+	// longer knows.
+	forgotten uint64
+}
+
+type topic struct {
+	subs    map[*subscription]struct{}
+	history []stored
+	// trimmed is the highest ID dropped from history. A client behind it
+	// cannot be replayed to.
+	trimmed uint64
+}
+
+type stored struct {
+	seq uint64
+	at  time.Time
+	Event
+}
+
+// subscription is one client's interest in a set of topics.
+type subscription struct {
+	topics []string
+	events chan Event
+	done   chan struct{}
+	evict  sync.Once
+	// reason says why done was closed. It is set before done closes.
+	reason disconnectReason
+	// active is when the client last accepted a write, in Unix nanoseconds.
+	active atomic.Int64
+}
+
+// replay is what a reconnecting client missed: the events still in history,
+// in ID order, and the topics whose history no longer reaches back far
+// enough. Latest is the ID of the newest event published so far.
+type replay struct {
+	Events []Event
+	Gaps   []string
+	Latest string
+}
+
+func newBroker() *broker {
+	return &broker{
+		replayEvents: defaultReplayEvents,
+		replayAge:    defaultReplayAge,
+		now:          time.Now,
+		epoch:        strconv.FormatInt(time.Now().UnixNano(), 36),
+		topics:       make(map[string]*topic),
+	}
+}
+
+// id formats the event ID for seq.
+func (b *broker) id(seq uint64) string {
+	return b.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// parseID returns the sequence number of an ID this broker issued. ok is
+// false for IDs of another epoch and for anything else it did not issue.
+func (b *broker) parseID(id string) (seq uint64, ok bool) {
+	epoch, n, found := strings.Cut(id, "-")
+	if !found || epoch != b.epoch {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(n, 10, 64)
+	if err != nil || seq > b.seq {
+		return 0, false
+	}
+	return seq, true
+}
+
+// Events delivers the events published to the subscribed topics.
+func (s *subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed when the broker evicts the subscriber for falling behind or
+// for being stale, see broker.reap. Reason then tells which.
+func (s *subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Reason returns why the subscription ended. It is only meaningful once Done
+// is closed.
+func (s *subscription) Reason() disconnectReason {
+	return s.reason
+}
+
+// touch records that the client accepted a write at t.
+func (s *subscription) touch(t time.Time) {
+	s.active.Store(t.UnixNano())
+}
+
+func (s *subscription) close(reason disconnectReason) {
+	s.evict.Do(func() {
+		s.reason = reason
+		close(s.done)
+	})
+}
+
+// subscribe registers interest in topics. When lastID is not empty it is
+// the client's Last-Event-ID and the returned replay holds what was
+// published after it. The subscription must be passed to unsubscribe when
+// the client goes away.
+func (b *broker) subscribe(topics []string, lastID string) (*subscription, replay) {
+	sub := &subscription{
+		topics: topics,
+		events: make(chan Event, subscriberBuffer),
+		done:   make(chan struct{}),
+	}
+	sub.touch(b.now())
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var r replay
+	if lastID != "" {
+		r = b.replay(topics, lastID)
+	}
+	for _, name := range topics {
+		b.topic(name).subs[sub] = struct{}{}
+	}
+	return sub, r
+}
+
+// replay collects the events of topics after lastID. The caller holds b.mu.
+func (b *broker) replay(topics []string, lastID string) replay {
+	r := replay{Latest: b.id(b.seq)}
+	last, ok := b.parseID(lastID)
+	if !ok {
+		// Not an ID of this broker, e.g. from before a restart.
+		r.Gaps = topics
+		return r
+	}
+	var missed []stored
+	now := b.now()
+	for _, name := range topics {
+		t, ok := b.topics[name]
+		if !ok {
+			if last < b.forgotten {
+				r.Gaps = append(r.Gaps, name)
+			}
+			continue
+		}
+		b.trim(t, now)
+		if last < t.trimmed {
+			r.Gaps = append(r.Gaps, name)
+			continue
+		}
+		i := sort.Search(len(t.history), func(i int) bool { return t.history[i].seq > last })
+		missed = append(missed, t.history[i:]...)
+	}
+	sort.Slice(missed, func(i, j int) bool { return missed[i].seq < missed[j].seq })
+	for _, s := range missed {
+		r.Events = append(r.Events, s.Event)
+	}
+	return r
+}
+
+// unsubscribe removes sub from all its topics. It is safe to call more than
+// once.
+func (b *broker) unsubscribe(sub *subscription) {
+	sub.close(disconnectClient)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(sub)
+}
+
+// remove drops sub from its topics. The caller holds b.mu.
+func (b *broker) remove(sub *subscription) {
+	for _, name := range sub.topics {
+		if t, ok := b.topics[name]; ok {
+			delete(t.subs, sub)
+			b.forgetIdle(name, t)
+		}
+	}
+}
+
+// publish assigns e the next ID, records it in the topic's history and sends
+// it to every subscriber of the topic. Subscribers that cannot keep up are
+// evicted. It returns the stored event and how many subscribers received it.
+func (b *broker) publish(name string, e Event) (Event, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.add(b.topic(name), name, e)
+}
+
+// publishAll publishes events to one topic in order and returns them with
+// their IDs. The events get consecutive IDs unless some carry a Key that is
+// still in the topic's history: such an event was published before, so the
+// earlier event is returned in its place and nothing is sent.
+func (b *broker) publishAll(name string, events []Event) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.topic(name)
+	published := make([]Event, len(events))
+	for i, e := range events {
+		if prev, ok := t.lookup(e.Key); ok {
+			published[i] = prev
+			continue
+		}
+		published[i], _ = b.add(t, name, e)
+	}
+	return published
+}
+
+// add is publish for a topic the caller already holds b.mu for.
+func (b *broker) add(t *topic, name string, e Event) (Event, int) {
+	b.seq++
+	e.ID = b.id(b.seq)
+	e.Topic = name
+	now := b.now()
+	t.history = append(t.history, stored{seq: b.seq, at: now, Event: e})
+	b.trim(t, now)
+
+	delivered := 0
+	for sub := range t.subs {
+		select {
+		case sub.events <- e:
+			delivered++
+		default:
+			sub.close(disconnectSlow)
+			b.remove(sub)
+		}
+	}
+	return e, delivered
+}
+
+// lookup finds the event published with key in the topic's history.
+func (t *topic) lookup(key string) (Event, bool) {
+	if key == "" {
+		return Event{}, false
+	}
+	for i := len(t.history) - 1; i >= 0; i-- {
+		if t.history[i].Key == key {
+			return t.history[i].Event, true
+		}
+	}
+	return Event{}, false
+}
+
+// trim drops history beyond the count and age limits. The caller holds b.mu.
+func (b *broker) trim(t *topic, now time.Time) {
+	drop := 0
+	if over := len(t.history) - b.replayEvents; over > 0 {
+		drop = over
+	}
+	for drop < len(t.history) && now.Sub(t.history[drop].at) > b.replayAge {
+		drop++
+	}
+	if drop == 0 {
+		return
+	}
+	t.trimmed = t.history[drop-1].seq
+	// Appending to the shortened slice reallocates once its capacity runs
+	// out, which releases the dropped events.
+	t.history = t.history[drop:]
+}
+
+// forgetIdle deletes a topic that has neither subscribers nor history. Its
+// trimmed marker is folded into b.forgotten, so a client behind it still
+// gets a reset. The caller holds b.mu.
+func (b *broker) forgetIdle(name string, t *topic) {
+	if len(t.subs) > 0 || len(t.history) > 0 {
+		return
+	}
+	b.forgotten = max(b.forgotten, t.trimmed)
+	delete(b.topics, name)
+}
+
+// sweep applies the replay limits to every topic and forgets the topics
+// left idle. Without it, history of topics nobody publishes to or replays
+// any more would never age out.
+func (b *broker) sweep() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	for name, t := range b.topics {
+		b.trim(t, now)
+		b.forgetIdle(name, t)
+	}
+}
+
+// reap evicts every subscriber that has not accepted a write since cutoff
+// and returns how many it evicted. It catches clients whose handler cannot
+// notice a dead connection by itself, e.g. because the response writer does
+// not support write deadlines; such a handler is blocked in a write, so
+// evicting it only takes effect once abortStuck closes its connection.
+func (b *broker) reap(cutoff time.Time) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stale := make(map[*subscription]struct{})
+	for _, t := range b.topics {
+		for sub := range t.subs {
+			if sub.active.Load() < cutoff.UnixNano() {
+				stale[sub] = struct{}{}
+			}
+		}
+	}
+	for sub := range stale {
+		sub.close(disconnectStale)
+		b.remove(sub)
+	}
+	return len(stale)
+}
+
+// subscriptions returns the number of distinct subscriptions across all
+// topics.
+func (b *broker) subscriptions() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	all := make(map[*subscription]struct{})
+	for _, t := range b.topics {
+		for sub := range t.subs {
+			all[sub] = struct{}{}
+		}
+	}
+	return len(all)
+}
+
+// subscribers returns the number of subscribers of topic.
+func (b *broker) subscribers(name string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.topics[name]; ok {
+		return len(t.subs)
+	}
+	return 0
+}
+
+// topic returns the named topic, creating it on first use. A new topic may
+// be an earlier one that was forgotten, so it starts out as if everything
+// up to b.forgotten had been trimmed. The caller holds b.mu.
+func (b *broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{subs: make(map[*subscription]struct{}), trimmed: b.forgotten}
+		b.topics[name] = t
+	}
+	return t
+}
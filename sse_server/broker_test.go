@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBrokerFanOut(t *testing.T) {
+	b := newBroker()
+	b.epoch = "e"
+	jobs, _ := b.subscribe([]string{"jobs"}, "")
+	both, _ := b.subscribe([]string{"jobs", "alerts"}, "")
+	defer b.unsubscribe(jobs)
+	defer b.unsubscribe(both)
+
+	if _, n := b.publish("jobs", Event{Data: "j"}); n != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", n)
+	}
+	if _, n := b.publish("alerts", Event{Data: "a"}); n != 1 {
+		t.Fatalf("expected 1 delivery, got %d", n)
+	}
+	if _, n := b.publish("nobody", Event{Data: "n"}); n != 0 {
+		t.Fatalf("expected no deliveries, got %d", n)
+	}
+	if e := <-jobs.Events(); e.Data != "j" || e.Topic != "jobs" || e.ID != "e-1" {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	for _, want := range []string{"j", "a"} {
+		if e := <-both.Events(); e.Data != want {
+			t.Fatalf("expected %q, got %+v", want, e)
+		}
+	}
+}
+
+func TestBrokerEvictsSlowSubscribers(t *testing.T) {
+	b := newBroker()
+	slow, _ := b.subscribe([]string{"jobs"}, "")
+	fast, _ := b.subscribe([]string{"jobs"}, "")
+	defer b.unsubscribe(fast)
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.publish("jobs", Event{Data: fmt.Sprint(i)})
+		<-fast.Events()
+	}
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("slow subscriber was not evicted")
+	}
+	select {
+	case <-fast.Done():
+		t.Fatal("fast subscriber was evicted")
+	default:
+	}
+	if slow.Reason() != disconnectSlow {
+		t.Fatalf("expected reason slow, got %s", slow.Reason())
+	}
+	if n := b.subscribers("jobs"); n != 1 {
+		t.Fatalf("expected 1 subscriber left, got %d", n)
+	}
+	b.unsubscribe(slow)
+}
+
+func TestBrokerReap(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBroker()
+	b.now = func() time.Time { return start }
+	idle, _ := b.subscribe([]string{"jobs", "alerts"}, "")
+	busy, _ := b.subscribe([]string{"jobs"}, "")
+	defer b.unsubscribe(busy)
+
+	busy.touch(start.Add(time.Minute))
+	if n := b.reap(start); n != 0 {
+		t.Fatalf("expected nothing reaped at the cutoff, got %d", n)
+	}
+	if n := b.reap(start.Add(time.Second)); n != 1 {
+		t.Fatalf("expected 1 subscriber reaped, got %d", n)
+	}
+	select {
+	case <-idle.Done():
+	default:
+		t.Fatal("reaped subscriber was not closed")
+	}
+	if idle.Reason() != disconnectStale {
+		t.Fatalf("expected reason stale, got %s", idle.Reason())
+	}
+	if got := b.subscriptions(); got != 1 {
+		t.Fatalf("expected 1 subscription left, got %d", got)
+	}
+	if n := b.subscribers("alerts"); n != 0 {
+		t.Fatalf("expected reaped subscriber to leave alerts, got %d", n)
+	}
+	// The handler still unsubscribes when it notices.
+	b.unsubscribe(idle)
+	if idle.Reason() != disconnectStale {
+		t.Fatalf("unsubscribe changed the reason to %s", idle.Reason())
+	}
+}
+
+func TestBrokerConcurrency(t *testing.T) {
+	b := newBroker()
+	var wg sync.WaitGroup
+	for i := 0; i < 2000; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sub, _ := b.subscribe([]string{fmt.Sprint("t", i%10), "all"}, "")
+			b.publish("all", Event{Data: "x"})
+			b.unsubscribe(sub)
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 10; i++ {
+		if n := b.subscribers(fmt.Sprint("t", i)); n != 0 {
+			t.Fatalf("t%d: expected no subscribers, got %d", i, n)
+		}
+	}
+	if n := b.subscribers("all"); n != 0 {
+		t.Fatalf("expected no subscribers, got %d", n)
+	}
+}
+
+func TestBrokerReplay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBroker()
+	b.now = func() time.Time { return now }
+	b.replayAge = time.Minute
+	b.epoch = "e"
+
+	for i := 0; i < 3; i++ {
+		b.publish("jobs", Event{Data: fmt.Sprint(i)})
+		now = now.Add(30 * time.Second)
+	}
+	b.publish("alerts", Event{Data: "a"})
+
+	tests := []struct {
+		lastID string
+		want   []string
+		gaps   []string
+	}{
+		// Event 1 is older than a minute, 2 is exactly a minute old.
+		{"e-1", []string{"e-2", "e-3", "e-4"}, nil},
+		{"e-3", []string{"e-4"}, nil},
+		{"e-4", nil, nil},
+		{"e-0", []string{"e-4"}, []string{"jobs"}},
+		{"e-5", nil, []string{"jobs", "alerts"}},
+		// IDs from before a restart, and anything else not issued here.
+		{"d-1", nil, []string{"jobs", "alerts"}},
+		{"1", nil, []string{"jobs", "alerts"}},
+		{"e-", nil, []string{"jobs", "alerts"}},
+		{"garbage", nil, []string{"jobs", "alerts"}},
+	}
+	for _, test := range tests {
+		sub, r := b.subscribe([]string{"jobs", "alerts"}, test.lastID)
+		b.unsubscribe(sub)
+		var got []string
+		for _, e := range r.Events {
+			got = append(got, e.ID)
+		}
+		if !slices.Equal(got, test.want) || !slices.Equal(r.Gaps, test.gaps) || r.Latest != "e-4" {
+			t.Fatalf("Last-Event-ID %s: expected %v and gaps %v, got %v and %+v", test.lastID, test.want, test.gaps, got, r)
+		}
+	}
+}
+
+func TestBrokerSweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newBroker()
+	b.now = func() time.Time { return now }
+	b.replayAge = time.Minute
+	b.epoch = "e"
+
+	b.publish("jobs", Event{Data: "old"})
+	sub, _ := b.subscribe([]string{"alerts"}, "")
+	now = now.Add(2 * time.Minute)
+	b.sweep()
+
+	if _, ok := b.topics["jobs"]; ok {
+		t.Fatalf("expected the idle topic to be forgotten")
+	}
+	if _, ok := b.topics["alerts"]; !ok {
+		t.Fatalf("expected the subscribed topic to be kept")
+	}
+	b.unsubscribe(sub)
+	if len(b.topics) != 0 {
+		t.Fatalf("expected no topics after the last unsubscribe, got %d", len(b.topics))
+	}
+
+	// The topic is gone, so a client behind its history is told about a gap
+	// for it and for every other topic the broker no longer knows.
+	sub, r := b.subscribe([]string{"jobs", "other"}, "e-0")
+	b.unsubscribe(sub)
+	if len(r.Events) != 0 || !slices.Equal(r.Gaps, []string{"jobs", "other"}) {
+		t.Fatalf("expected gaps for both topics, got %+v", r)
+	}
+	sub, r = b.subscribe([]string{"jobs"}, "e-1")
+	b.unsubscribe(sub)
+	if len(r.Events) != 0 || len(r.Gaps) != 0 {
+		t.Fatalf("expected a client that saw everything to resume, got %+v", r)
+	}
+
+	// A recreated topic keeps the marker, so its first event is no reason
+	// to resume a client that is behind the forgotten history.
+	b.publish("jobs", Event{Data: "new"})
+	sub, r = b.subscribe([]string{"jobs"}, "e-0")
+	b.unsubscribe(sub)
+	if !slices.Equal(r.Gaps, []string{"jobs"}) {
+		t.Fatalf("expected a gap for the recreated topic, got %+v", r)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// connKey is the context key under which connContext stores the client's
+// connection.
+type connKey struct{}
+
+// connContext is meant for http.Server.ConnContext. It makes the raw
+// connection available to handlers so abortStuck can close it.
+func (s *server) connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connKey{}, c)
+}
+
+// abortStuck closes the client's connection if the handler has not finished
+// s.evictGrace after the broker evicted sub. Such a handler is blocked in a
+// write that has no deadline, or a far-off one, and would otherwise keep its
+// goroutine and connection. Without connContext there is no connection to
+// close and the handler stays until its write returns.
+func (s *server) abortStuck(ctx context.Context, sub *subscription, finished <-chan struct{}) {
+	select {
+	case <-finished:
+		return
+	case <-sub.Done():
+	}
+	timer := time.NewTimer(s.evictGrace)
+	defer timer.Stop()
+	select {
+	case <-finished:
+	case <-timer.C:
+		if conn, ok := ctx.Value(connKey{}).(net.Conn); ok {
+			conn.Close()
+		}
+	}
+}
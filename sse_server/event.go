@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one message of a text/event-stream.
+type Event struct {
+	// ID becomes the client's Last-Event-ID. Empty IDs are not sent.
+	ID string
+	// Event is the event type; browsers dispatch it to listeners of that
+	// name. Empty means "message".
+	Event string
+	// Data is the payload. It may span several lines.
+	Data string
+	// Retry tells the client how long to wait before reconnecting. Zero is
+	// not sent.
+	Retry time.Duration
+	// Topic is the topic the event was published to. It is not part of the
+	// wire format.
+	Topic string
+	// Key is an optional idempotency key chosen by the publisher, see
+	// broker.publishAll. It is not part of the wire format.
+	Key string
+}
+
+// lineBreaks normalises the line endings the event-stream format accepts,
+// so a payload containing "\r\n" or "\r" cannot end a field early.
+var lineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// WriteTo encodes e in the event-stream format and writes it with a single
+// Write. Every line of Data gets its own data: field, so the client
+// reassembles it exactly; line breaks in ID and Event are dropped because
+// they would start a new field.
+func (e Event) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if e.ID != "" {
+		writeField(&buf, "id", singleLine(e.ID))
+	}
+	if e.Event != "" {
+		writeField(&buf, "event", singleLine(e.Event))
+	}
+	if e.Retry > 0 {
+		writeField(&buf, "retry", strconv.FormatInt(e.Retry.Milliseconds(), 10))
+	}
+	if e.Data != "" || buf.Len() == 0 {
+		for _, line := range strings.Split(lineBreaks.Replace(e.Data), "\n") {
+			writeField(&buf, "data", line)
+		}
+	}
+	buf.WriteByte('\n')
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+func writeField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	buf.WriteString(": ")
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+func singleLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == 0 {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// comment is a comment line of an event-stream. Clients ignore it, but it
+// keeps idle connections from being closed by proxies.
+type comment string
+
+// WriteTo writes the comment as its own block.
+func (c comment) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, ": "+singleLine(string(c))+"\n\n")
+	return int64(n), err
+}
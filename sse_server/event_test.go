@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventWriteTo(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{Event{Data: "hello"}, "data: hello\n\n"},
+		{Event{}, "data: \n\n"},
+		{Event{ID: "7", Event: "job", Data: "a\nb\r\nc\rd"}, "id: 7\nevent: job\ndata: a\ndata: b\ndata: c\ndata: d\n\n"},
+		{Event{Data: "trailing\n"}, "data: trailing\ndata: \n\n"},
+		{Event{ID: "1\n2", Event: "x\ry", Data: "z"}, "id: 12\nevent: xy\ndata: z\n\n"},
+		{Event{Retry: 1500 * time.Millisecond}, "retry: 1500\n\n"},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		n, err := test.event.WriteTo(&b)
+		if err != nil {
+			t.Fatalf("%+v: %v", test.event, err)
+		}
+		if b.String() != test.want || int(n) != len(test.want) {
+			t.Fatalf("%+v: expected %q, got %q (%d bytes)", test.event, test.want, b.String(), n)
+		}
+	}
+}
+
+func TestCommentWriteTo(t *testing.T) {
+	var b strings.Builder
+	if _, err := comment("ping\nid: 9").WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	if want := ": pingid: 9\n\n"; b.String() != want {
+		t.Fatalf("expected %q, got %q", want, b.String())
+	}
+}
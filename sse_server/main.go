@@ -1,19 +1,38 @@
 package main
 
 import (
+	"context"
+	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	r := gin.Default()
+	s := newServer()
+	s.publishToken = os.Getenv("SSE_PUBLISH_TOKEN")
+	s.heartbeat = envDuration("SSE_HEARTBEAT", s.heartbeat)
+	s.writeTimeout = envDuration("SSE_WRITE_TIMEOUT", s.writeTimeout)
+	go s.maintain(context.Background())
 
-	r.GET("/", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "Hello SSE",
-		})
-	})
+	r := gin.Default()
+	s.routes(r)
+	srv := &http.Server{Addr: ":8080", Handler: r, ConnContext: s.connContext}
+	log.Fatal(srv.ListenAndServe())
+}
 
-	r.Run(":8080")
+// envDuration parses the named environment variable, e.g. "30s", or returns
+// def when it is unset. "0" disables the setting.
+func envDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("%s: invalid duration %q", name, v)
+	}
+	return d
 }
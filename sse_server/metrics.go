@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// disconnectReason says why an event stream ended.
+type disconnectReason int
+
+const (
+	// disconnectClient: the client closed the connection.
+	disconnectClient disconnectReason = iota
+	// disconnectSlow: the broker evicted the client for falling behind.
+	disconnectSlow
+	// disconnectDead: a write failed or missed its deadline.
+	disconnectDead
+	// disconnectStale: the reaper found no successful write for too long.
+	disconnectStale
+	disconnectReasonCount
+)
+
+var disconnectReasonNames = [disconnectReasonCount]string{"client", "slow", "dead", "stale"}
+
+func (r disconnectReason) String() string {
+	if r < 0 || r >= disconnectReasonCount {
+		return fmt.Sprintf("disconnectReason(%d)", int(r))
+	}
+	return disconnectReasonNames[r]
+}
+
+// metrics counts event streams. connections only returns to its previous
+// value once a handler has really finished, so it shows whether dead clients
+// are cleaned up.
+type metrics struct {
+	connections atomic.Int64
+	disconnects [disconnectReasonCount]atomic.Int64
+	reaped      atomic.Int64
+}
+
+func (m *metrics) connected() {
+	m.connections.Add(1)
+}
+
+func (m *metrics) disconnected(reason disconnectReason) {
+	m.connections.Add(-1)
+	m.disconnects[reason].Add(1)
+}
+
+// handleMetrics reports the metrics in the Prometheus text format.
+func (s *server) handleMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	c.Status(http.StatusOK)
+	w := c.Writer
+	fmt.Fprintln(w, "# HELP sse_connections Open event streams.")
+	fmt.Fprintln(w, "# TYPE sse_connections gauge")
+	fmt.Fprintf(w, "sse_connections %d\n", s.metrics.connections.Load())
+	fmt.Fprintln(w, "# HELP sse_subscriptions Subscriptions registered with the broker.")
+	fmt.Fprintln(w, "# TYPE sse_subscriptions gauge")
+	fmt.Fprintf(w, "sse_subscriptions %d\n", s.broker.subscriptions())
+	fmt.Fprintln(w, "# HELP sse_disconnects_total Closed event streams by reason.")
+	fmt.Fprintln(w, "# TYPE sse_disconnects_total counter")
+	for r := disconnectReason(0); r < disconnectReasonCount; r++ {
+		fmt.Fprintf(w, "sse_disconnects_total{reason=%q} %d\n", r, s.metrics.disconnects[r].Load())
+	}
+	fmt.Fprintln(w, "# HELP sse_reaped_total Subscriptions evicted by the stale-connection reaper.")
+	fmt.Fprintln(w, "# TYPE sse_reaped_total counter")
+	fmt.Fprintf(w, "sse_reaped_total %d\n", s.metrics.reaped.Load())
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Publish API limits.
+const (
+	maxPublishBody  = 1 << 20
+	maxEventData    = 64 << 10
+	maxPublishBatch = 100
+	maxEventType    = 64
+	maxEventKey     = 128
+)
+
+// publishRequest is one event in a POST /topics/:name/events body. Data may
+// be a JSON string, which is sent as is, or any other JSON value, which is
+// sent in its compact encoding. Data must not be empty, and unknown fields
+// are rejected.
+type publishRequest struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+	ID    string          `json:"id"`
+}
+
+// errTooLarge marks validation errors answered with 413.
+var errTooLarge = errors.New("payload too large")
+
+// handlePublish publishes the events in the body to the topic in the path.
+// The body is either one event object, answered with {"id": ...}, or an
+// array of up to maxPublishBatch of them, answered with {"ids": [...]}. The
+// optional id of a request is an idempotency key: publishing it again while
+// the first event is still in the topic's replay history returns the ID
+// assigned the first time.
+func (s *server) handlePublish(c *gin.Context) {
+	if !s.authorized(c.GetHeader("Authorization")) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing or invalid publisher token"})
+		return
+	}
+	name := c.Param("name")
+	if !validTopic(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid topic name %q", name)})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPublishBody)
+	var body json.RawMessage
+	dec := json.NewDecoder(c.Request.Body)
+	err := dec.Decode(&body)
+	if err == nil {
+		if dec.Decode(&json.RawMessage{}) != io.EOF {
+			err = errors.New("unexpected data after the JSON value")
+		}
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("body exceeds %d bytes", maxPublishBody)})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "decode body: " + err.Error()})
+		return
+	}
+
+	batch := bytes.HasPrefix(bytes.TrimSpace(body), []byte("["))
+	var reqs []publishRequest
+	if batch {
+		if err := decodeStrict(body, &reqs); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "decode body: " + err.Error()})
+			return
+		}
+		if len(reqs) == 0 || len(reqs) > maxPublishBatch {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("a batch holds 1 to %d events", maxPublishBatch)})
+			return
+		}
+	} else {
+		var req publishRequest
+		if err := decodeStrict(body, &req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "decode body: " + err.Error()})
+			return
+		}
+		reqs = []publishRequest{req}
+	}
+
+	events := make([]Event, len(reqs))
+	for i, req := range reqs {
+		e, err := req.toEvent()
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, errTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			if batch {
+				err = fmt.Errorf("event %d: %w", i, err)
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		events[i] = e
+	}
+
+	published := s.broker.publishAll(name, events)
+	if !batch {
+		c.JSON(http.StatusOK, gin.H{"id": published[0].ID})
+		return
+	}
+	ids := make([]string, len(published))
+	for i, e := range published {
+		ids[i] = e.ID
+	}
+	c.JSON(http.StatusOK, gin.H{"ids": ids})
+}
+
+// authorized checks a "Bearer <token>" header against the publisher token.
+// Publishing is refused altogether while no token is configured.
+func (s *server) authorized(header string) bool {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || s.publishToken == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.publishToken)) == 1
+}
+
+// decodeStrict decodes data into v, rejecting fields v does not have.
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func (req publishRequest) toEvent() (Event, error) {
+	switch {
+	case len(req.Event) > maxEventType:
+		return Event{}, fmt.Errorf("event type longer than %d bytes", maxEventType)
+	case strings.ContainsAny(req.Event, "\r\n\x00"):
+		return Event{}, errors.New("event type must be a single line")
+	case len(req.ID) > maxEventKey:
+		return Event{}, fmt.Errorf("id longer than %d bytes", maxEventKey)
+	case strings.ContainsAny(req.ID, "\r\n\x00"):
+		return Event{}, errors.New("id must be a single line")
+	case len(req.Data) == 0 || string(req.Data) == "null":
+		return Event{}, errors.New("data is required")
+	}
+
+	var data string
+	if err := json.Unmarshal(req.Data, &data); err != nil {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, req.Data); err != nil {
+			return Event{}, fmt.Errorf("data: %w", err)
+		}
+		data = compact.String()
+	}
+	if data == "" {
+		// An event without data lines is never dispatched by EventSource.
+		return Event{}, errors.New("data must not be empty")
+	}
+	if len(data) > maxEventData {
+		return Event{}, fmt.Errorf("%w: data exceeds %d bytes", errTooLarge, maxEventData)
+	}
+	return Event{Event: req.Event, Data: data, Key: req.ID}, nil
+}
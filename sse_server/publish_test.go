@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func post(t *testing.T, url, token, body string) (int, map[string]any) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var got map[string]any
+	json.NewDecoder(resp.Body).Decode(&got)
+	return resp.StatusCode, got
+}
+
+func TestPublish(t *testing.T) {
+	s := newServer()
+	s.publishToken = "secret"
+	s.broker.epoch = "e"
+	ts := newTestServer(t, s)
+	url := ts.URL + "/topics/jobs/events"
+
+	r, disconnect := openStream(t, ts, "/events?topics=jobs", nil)
+	defer disconnect()
+
+	status, got := post(t, url, "secret", `{"event": "job", "data": "line one\nline two"}`)
+	if status != http.StatusOK || got["id"] != "e-1" {
+		t.Fatalf("single: %d %v", status, got)
+	}
+	if block, want := readBlock(t, r), "id: e-1\nevent: job\ndata: line one\ndata: line two\n"; block != want {
+		t.Fatalf("expected %q, got %q", want, block)
+	}
+
+	status, got = post(t, url, "secret", `[{"data": {"n": 1}, "id": "k1"}, {"data": [1, 2], "id": "k2"}, {"data": "again", "id": "k1"}]`)
+	ids, _ := got["ids"].([]any)
+	if status != http.StatusOK || len(ids) != 3 || ids[0] != "e-2" || ids[1] != "e-3" || ids[2] != "e-2" {
+		t.Fatalf("batch: %d %v", status, got)
+	}
+	for _, want := range []string{"id: e-2\ndata: {\"n\":1}\n", "id: e-3\ndata: [1,2]\n"} {
+		if block := readBlock(t, r); block != want {
+			t.Fatalf("expected %q, got %q", want, block)
+		}
+	}
+}
+
+func TestPublishRejects(t *testing.T) {
+	s := newServer()
+	s.publishToken = "secret"
+	ts := newTestServer(t, s)
+	url := ts.URL + "/topics/jobs/events"
+
+	tests := []struct {
+		name   string
+		url    string
+		token  string
+		body   string
+		status int
+	}{
+		{"no token", url, "", `{"data": "x"}`, http.StatusUnauthorized},
+		{"wrong token", url, "guess", `{"data": "x"}`, http.StatusUnauthorized},
+		{"bad topic", ts.URL + "/topics/-bad/events", "secret", `{"data": "x"}`, http.StatusBadRequest},
+		{"not json", url, "secret", `data`, http.StatusBadRequest},
+		{"no data", url, "secret", `{"event": "job"}`, http.StatusBadRequest},
+		{"empty data", url, "secret", `{"data": ""}`, http.StatusBadRequest},
+		{"unknown field", url, "secret", `{"data": "x", "evnt": "typo"}`, http.StatusBadRequest},
+		{"unknown field in batch", url, "secret", `[{"data": "x"}, {"data": "y", "evnt": "typo"}]`, http.StatusBadRequest},
+		{"trailing data", url, "secret", `{"data": "x"} trailing`, http.StatusBadRequest},
+		{"second value", url, "secret", `{"data": "x"} {"data": "y"}`, http.StatusBadRequest},
+		{"multi-line type", url, "secret", `{"event": "a\nb", "data": "x"}`, http.StatusBadRequest},
+		{"long id", url, "secret", `{"id": "` + strings.Repeat("k", maxEventKey+1) + `", "data": "x"}`, http.StatusBadRequest},
+		{"empty batch", url, "secret", `[]`, http.StatusBadRequest},
+		{"large batch", url, "secret", "[" + strings.Repeat(`{"data": "x"},`, maxPublishBatch) + `{"data": "x"}]`, http.StatusBadRequest},
+		{"large data", url, "secret", `{"data": "` + strings.Repeat("x", maxEventData+1) + `"}`, http.StatusRequestEntityTooLarge},
+		{"large body", url, "secret", `{"data": "` + strings.Repeat("x", maxPublishBody) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		status, got := post(t, test.url, test.token, test.body)
+		if status != test.status || got["error"] == nil {
+			t.Fatalf("%s: expected %d with an error, got %d %v", test.name, test.status, status, got)
+		}
+	}
+	if _, r := s.broker.subscribe([]string{"jobs"}, s.broker.id(0)); len(r.Events) != 0 {
+		t.Fatalf("rejected requests published %v", r.Events)
+	}
+
+	s.publishToken = ""
+	if status, _ := post(t, url, "", `{"data": "x"}`); status != http.StatusUnauthorized {
+		t.Fatalf("publishing without a configured token: expected 401, got %d", status)
+	}
+}
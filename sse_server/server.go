@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stream defaults used by newServer.
+const (
+	// defaultRetry is the reconnection delay suggested to clients.
+	defaultRetry = 3 * time.Second
+	// defaultHeartbeat is shorter than the 30 to 60 second idle timeouts
+	// common in proxies and load balancers.
+	defaultHeartbeat    = 15 * time.Second
+	defaultWriteTimeout = 10 * time.Second
+	// defaultEvictGrace is how long an evicted stream's handler may take to
+	// notice before its connection is closed, see abortStuck.
+	defaultEvictGrace = time.Second
+	// sweepInterval is how often idle replay history is trimmed at the
+	// latest.
+	sweepInterval = time.Minute
+)
+
+type server struct {
+	broker *broker
+	retry  time.Duration
+	// heartbeat is how long a stream may stay silent before a ": ping"
+	// comment is sent. Zero disables heartbeats and the reaper.
+	heartbeat time.Duration
+	// writeTimeout bounds every write to a client. Zero disables it.
+	writeTimeout time.Duration
+	evictGrace   time.Duration
+	// publishToken authorizes POST /topics/:name/events. Publishing is
+	// disabled while it is empty.
+	publishToken string
+	metrics      metrics
+}
+
+func newServer() *server {
+	return &server{
+		broker:       newBroker(),
+		retry:        defaultRetry,
+		heartbeat:    defaultHeartbeat,
+		writeTimeout: defaultWriteTimeout,
+		evictGrace:   defaultEvictGrace,
+	}
+}
+
+func (s *server) routes(r *gin.Engine) {
+	r.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Hello SSE",
+		})
+	})
+	r.GET("/events", s.handleEvents)
+	r.POST("/topics/:name/events", s.handlePublish)
+	r.GET("/metrics", s.handleMetrics)
+}
+
+// handleEvents streams the events published to the topics listed in the
+// topics query parameter until the client disconnects or falls too far
+// behind. A reconnecting client's Last-Event-ID header is honoured: it first
+// receives the events it missed and, if some topic's history does not reach
+// back far enough, a reset event, see resetEvent.
+//
+// A stream that stays silent for s.heartbeat gets a ": ping" comment, and
+// every write must finish within s.writeTimeout; a failed write ends the
+// stream, so dead connections do not hold on to their handler.
+func (s *server) handleEvents(c *gin.Context) {
+	topics, err := parseTopics(c.Query("topics"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub, missed := s.broker.subscribe(topics, c.GetHeader("Last-Event-ID"))
+	defer s.broker.unsubscribe(sub)
+	s.metrics.connected()
+	// A failed write cancels the request context too, so the reason is
+	// decided where the stream ends rather than from ctx.Err.
+	reason := disconnectDead
+	defer func() { s.metrics.disconnected(reason) }()
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	// Stop nginx and similar proxies from buffering the stream.
+	h.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go s.abortStuck(c.Request.Context(), sub, finished)
+
+	out := newStream(c.Writer, s.writeTimeout)
+	blocks := []io.WriterTo{Event{Retry: s.retry}}
+	for _, e := range missed.Events {
+		blocks = append(blocks, e)
+	}
+	if len(missed.Gaps) > 0 {
+		blocks = append(blocks, resetEvent(missed))
+	}
+	if out.send(blocks...) != nil {
+		reason = writeFailed(sub)
+		return
+	}
+	sub.touch(time.Now())
+
+	var (
+		heartbeat *time.Ticker
+		ping      <-chan time.Time
+	)
+	if s.heartbeat > 0 {
+		heartbeat = time.NewTicker(s.heartbeat)
+		defer heartbeat.Stop()
+		ping = heartbeat.C
+	}
+	ctx := c.Request.Context()
+	for {
+		var block io.WriterTo
+		select {
+		case <-ctx.Done():
+			reason = disconnectClient
+			return
+		case <-sub.Done():
+			reason = sub.Reason()
+			return
+		case e := <-sub.Events():
+			block = e
+		case <-ping:
+			block = comment("ping")
+		}
+		if out.send(block) != nil {
+			reason = writeFailed(sub)
+			return
+		}
+		sub.touch(time.Now())
+		if heartbeat != nil {
+			heartbeat.Reset(s.heartbeat)
+		}
+	}
+}
+
+// writeFailed returns why a stream whose write failed ended: the eviction
+// that made abortStuck close the connection, if any, or a dead connection.
+func writeFailed(sub *subscription) disconnectReason {
+	select {
+	case <-sub.Done():
+		return sub.Reason()
+	default:
+		return disconnectDead
+	}
+}
+
+// maintain does the periodic housekeeping until ctx is done: every
+// sweepInterval, or every heartbeat if that is shorter, it lets replay
+// history age out, see broker.sweep, and evicts subscribers that accepted
+// no write for two heartbeats plus the write timeout. Healthy streams write
+// at least once per heartbeat, so only clients whose connection is dead but
+// went unnoticed are evicted. Nobody is evicted while heartbeats are
+// disabled, because idle streams would look dead.
+func (s *server) maintain(ctx context.Context) {
+	interval := sweepInterval
+	if s.heartbeat > 0 && s.heartbeat < interval {
+		interval = s.heartbeat
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.broker.sweep()
+			if s.heartbeat > 0 {
+				n := s.broker.reap(now.Add(-s.staleAfter()))
+				s.metrics.reaped.Add(int64(n))
+			}
+		}
+	}
+}
+
+// staleAfter is how long a subscriber may go without a successful write.
+func (s *server) staleAfter() time.Duration {
+	return 2*s.heartbeat + s.writeTimeout
+}
+
+// resetEvent tells a client that events of r.Gaps were lost and it has to
+// reload its state from elsewhere. The event carries the newest ID, so the
+// client continues from there once it reconnects.
+func resetEvent(r replay) Event {
+	data, _ := json.Marshal(gin.H{"topics": r.Gaps})
+	return Event{ID: r.Latest, Event: "reset", Data: string(data)}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func newTestServer(t *testing.T, s *server) *httptest.Server {
+	t.Helper()
+	r := gin.New()
+	s.routes(r)
+	ts := httptest.NewUnstartedServer(r)
+	ts.Config.ConnContext = s.connContext
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// openStream connects to path and returns a reader positioned after the
+// initial retry field, and a function that disconnects.
+func openStream(t *testing.T, ts *httptest.Server, path string, header http.Header) (*bufio.Reader, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		cancel()
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		cancel()
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+	r := bufio.NewReader(resp.Body)
+	if block := readBlock(t, r); !strings.HasPrefix(block, "retry: ") {
+		cancel()
+		t.Fatalf("expected a retry field first, got %q", block)
+	}
+	return r, cancel
+}
+
+// readBlock reads one event, up to and including the blank line ending it.
+func readBlock(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	var b strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v (got %q)", err, b.String())
+		}
+		if line == "\n" {
+			return b.String()
+		}
+		b.WriteString(line)
+	}
+}
+
+// eventually fails the test unless cond becomes true within a second.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEventsStream(t *testing.T) {
+	s := newServer()
+	s.broker.epoch = "e"
+	ts := newTestServer(t, s)
+	r, disconnect := openStream(t, ts, "/events?topics=jobs,alerts", nil)
+
+	eventually(t, "the client to subscribe", func() bool { return s.broker.subscribers("alerts") == 1 })
+	s.broker.publish("other", Event{Data: "not for us"})
+	s.broker.publish("jobs", Event{Event: "job", Data: "line one\nline two"})
+	if got, want := readBlock(t, r), "id: e-2\nevent: job\ndata: line one\ndata: line two\n"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	s.broker.publish("alerts", Event{Data: "disk full"})
+	if got, want := readBlock(t, r), "id: e-3\ndata: disk full\n"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	disconnect()
+	eventually(t, "the client to be removed", func() bool {
+		return s.broker.subscribers("jobs") == 0 && s.broker.subscribers("alerts") == 0
+	})
+}
+
+func TestEventsResume(t *testing.T) {
+	s := newServer()
+	s.broker.epoch = "e"
+	s.broker.replayEvents = 2
+	ts := newTestServer(t, s)
+	for _, topic := range []string{"jobs", "alerts", "jobs", "other", "jobs"} {
+		s.broker.publish(topic, Event{Data: topic})
+	}
+
+	// jobs keeps IDs 3 and 5, alerts keeps 2.
+	r, disconnect := openStream(t, ts, "/events?topics=jobs,alerts", http.Header{"Last-Event-Id": {"e-2"}})
+	for _, want := range []string{"id: e-3\ndata: jobs\n", "id: e-5\ndata: jobs\n"} {
+		if got := readBlock(t, r); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+	s.broker.publish("alerts", Event{Data: "live"})
+	if got, want := readBlock(t, r), "id: e-6\ndata: live\n"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	disconnect()
+
+	// ID 1 was dropped from jobs; alerts can still be replayed.
+	r, disconnect = openStream(t, ts, "/events?topics=jobs,alerts", http.Header{"Last-Event-Id": {"e-0"}})
+	defer disconnect()
+	for _, want := range []string{"id: e-2\ndata: alerts\n", "id: e-6\ndata: live\n", "id: e-6\nevent: reset\ndata: {\"topics\":[\"jobs\"]}\n"} {
+		if got := readBlock(t, r); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestEventsRejectsBadTopics(t *testing.T) {
+	ts := newTestServer(t, newServer())
+	for _, query := range []string{"", "?topics=", "?topics=ok,bad%20name", "?topics=" + strings.Repeat("t,", 10) + strings.Repeat("x", 65)} {
+		resp, err := http.Get(ts.URL + "/events" + query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%q: expected status 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestEventsHeartbeat(t *testing.T) {
+	s := newServer()
+	s.heartbeat = 20 * time.Millisecond
+	s.broker.epoch = "e"
+	ts := newTestServer(t, s)
+	r, disconnect := openStream(t, ts, "/events?topics=jobs", nil)
+	defer disconnect()
+
+	if got, want := readBlock(t, r), ": ping\n"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	s.broker.publish("jobs", Event{Data: "after ping"})
+	for {
+		block := readBlock(t, r)
+		if block == ": ping\n" {
+			continue
+		}
+		if want := "id: e-1\ndata: after ping\n"; block != want {
+			t.Fatalf("expected %q, got %q", want, block)
+		}
+		break
+	}
+}
+
+func TestEventsConnectionGauge(t *testing.T) {
+	s := newServer()
+	ts := newTestServer(t, s)
+	_, disconnect := openStream(t, ts, "/events?topics=jobs", nil)
+	r, _ := openStream(t, ts, "/events?topics=jobs,alerts", nil)
+	eventually(t, "two connections", func() bool { return s.metrics.connections.Load() == 2 })
+
+	disconnect()
+	eventually(t, "the client disconnect to be counted", func() bool {
+		return s.metrics.connections.Load() == 1 && s.metrics.disconnects[disconnectClient].Load() == 1
+	})
+
+	// The second stream looks dead to the reaper; its handler must end and
+	// release the connection.
+	if n := s.broker.reap(time.Now().Add(time.Hour)); n != 1 {
+		t.Fatalf("expected 1 subscriber reaped, got %d", n)
+	}
+	if _, err := r.ReadString('\n'); err != io.EOF {
+		t.Fatalf("expected the reaped stream to end, got %v", err)
+	}
+	eventually(t, "the reaped stream to be counted", func() bool {
+		return s.metrics.connections.Load() == 0 && s.metrics.disconnects[disconnectStale].Load() == 1
+	})
+	if n := s.broker.subscriptions(); n != 0 {
+		t.Fatalf("expected no subscriptions left, got %d", n)
+	}
+}
+
+func TestEventsWriteDeadline(t *testing.T) {
+	s := newServer()
+	// Every write misses its deadline.
+	s.writeTimeout = time.Nanosecond
+	ts := newTestServer(t, s)
+	if resp, err := http.Get(ts.URL + "/events?topics=jobs"); err == nil {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	eventually(t, "the dead connection to be counted", func() bool {
+		return s.metrics.connections.Load() == 0 && s.metrics.disconnects[disconnectDead].Load() == 1
+	})
+	if n := s.broker.subscriptions(); n != 0 {
+		t.Fatalf("expected no subscriptions left, got %d", n)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s := newServer()
+	ts := newTestServer(t, s)
+	_, disconnect := openStream(t, ts, "/events?topics=jobs", nil)
+	defer disconnect()
+	eventually(t, "the client to connect", func() bool { return s.metrics.connections.Load() == 1 })
+	s.metrics.disconnects[disconnectSlow].Add(2)
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		"\nsse_connections 1\n",
+		"\nsse_subscriptions 1\n",
+		"\nsse_disconnects_total{reason=\"slow\"} 2\n",
+		"\nsse_disconnects_total{reason=\"stale\"} 0\n",
+		"\nsse_reaped_total 0\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("expected %q in\n%s", want, body)
+		}
+	}
+}
+
+func TestEventsResumeAfterRestart(t *testing.T) {
+	before := newServer()
+	before.broker.publish("jobs", Event{Data: "old"})
+	before.broker.publish("jobs", Event{Data: "old"})
+	lastID := before.broker.id(2)
+
+	s := newServer()
+	s.broker.epoch = "e"
+	ts := newTestServer(t, s)
+	for i := 0; i < 3; i++ {
+		s.broker.publish("jobs", Event{Data: "new"})
+	}
+	// The old ID's number is in range, but its epoch tells it apart.
+	r, disconnect := openStream(t, ts, "/events?topics=jobs", http.Header{"Last-Event-Id": {lastID}})
+	defer disconnect()
+	if got, want := readBlock(t, r), "id: e-3\nevent: reset\ndata: {\"topics\":[\"jobs\"]}\n"; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestEventsAbortsStuckHandler(t *testing.T) {
+	s := newServer()
+	s.writeTimeout = 0
+	s.evictGrace = 20 * time.Millisecond
+	ts := newTestServer(t, s)
+
+	// A client that never reads, so the handler blocks in a write once the
+	// socket buffers are full.
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "GET /events?topics=jobs HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "the client to subscribe", func() bool { return s.broker.subscribers("jobs") == 1 })
+	queued := func() int {
+		s.broker.mu.Lock()
+		defer s.broker.mu.Unlock()
+		for sub := range s.broker.topics["jobs"].subs {
+			return len(sub.events)
+		}
+		return 0
+	}
+	// Publish until an event stays queued, i.e. the handler is stuck in a
+	// write.
+	data := strings.Repeat("x", 1<<20)
+	for stuck := false; !stuck; {
+		s.broker.publish("jobs", Event{Data: data})
+		deadline := time.Now().Add(100 * time.Millisecond)
+		for queued() > 0 && !stuck {
+			stuck = time.Now().After(deadline)
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if n := s.broker.reap(time.Now().Add(time.Hour)); n != 1 {
+		t.Fatalf("expected 1 subscriber reaped, got %d", n)
+	}
+	eventually(t, "the stuck handler to end", func() bool {
+		return s.metrics.connections.Load() == 0 && s.metrics.disconnects[disconnectStale].Load() == 1
+	})
+}
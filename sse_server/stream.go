@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stream writes event-stream blocks to one client. Every block is flushed
+// right away under a write deadline, so a client that stopped reading, such
+// as the far end of a half-open connection, fails the write instead of
+// blocking the handler forever.
+type stream struct {
+	w       gin.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration
+	// deadlines is false once the connection turned out not to support
+	// write deadlines; the reaper then has to catch dead clients.
+	deadlines bool
+}
+
+// newStream wraps w. A timeout of zero disables write deadlines.
+func newStream(w gin.ResponseWriter, timeout time.Duration) *stream {
+	// gin's Flush discards errors, so flushes go to the writer underneath.
+	var under http.ResponseWriter = w
+	if u, ok := w.(interface{ Unwrap() http.ResponseWriter }); ok {
+		under = u.Unwrap()
+	}
+	return &stream{w: w, rc: http.NewResponseController(under), timeout: timeout, deadlines: timeout > 0}
+}
+
+// send writes the blocks and flushes them.
+func (s *stream) send(blocks ...io.WriterTo) error {
+	if s.deadlines {
+		err := s.rc.SetWriteDeadline(time.Now().Add(s.timeout))
+		if errors.Is(err, http.ErrNotSupported) {
+			s.deadlines = false
+		} else if err != nil {
+			return err
+		}
+	}
+	for _, b := range blocks {
+		if _, err := b.WriteTo(s.w); err != nil {
+			return err
+		}
+	}
+	return s.rc.Flush()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxStreamTopics limits how many topics one stream may subscribe to.
+const maxStreamTopics = 32
+
+var topicName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// validTopic reports whether name may be used as a topic: 1 to 64 letters,
+// digits, dots, dashes or underscores, starting with a letter or digit.
+func validTopic(name string) bool {
+	return topicName.MatchString(name)
+}
+
+// parseTopics splits a comma-separated topic list, dropping duplicates and
+// empty entries.
+func parseTopics(list string) ([]string, error) {
+	var topics []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		if !validTopic(name) {
+			return nil, fmt.Errorf("invalid topic name %q", name)
+		}
+		seen[name] = true
+		topics = append(topics, name)
+	}
+	switch {
+	case len(topics) == 0:
+		return nil, fmt.Errorf("no topics given")
+	case len(topics) > maxStreamTopics:
+		return nil, fmt.Errorf("at most %d topics per stream", maxStreamTopics)
+	}
+	return topics, nil
+}
@@ -0,0 +1,295 @@
+package state_transform
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRequestNotFound = errors.New("approval request not found")
+	ErrRequestClosed   = errors.New("approval request is closed")
+	ErrRequestPending  = errors.New("dataset already has a pending publish request")
+	ErrSelfReview      = errors.New("creator and requester may not review their own request")
+	ErrNotReviewer     = errors.New("operator is not an eligible reviewer")
+	ErrAlreadyReviewed = errors.New("reviewer already reviewed the request")
+)
+
+// RequireApproval makes Check deny DatasetActionPublish with
+// ReasonApprovalRequired. Publishes then have to go through an
+// ApprovalWorkflow.
+func RequireApproval() Option {
+	return func(s *StateTransform) {
+		s.requireApproval = true
+	}
+}
+
+// withApproval marks the publish as backed by an approved request.
+func withApproval() Option {
+	return func(s *StateTransform) {
+		s.approved = true
+	}
+}
+
+// ApprovalStatus is the lifecycle state of an ApprovalRequest.
+type ApprovalStatus string
+
+const (
+	ApprovalPending   ApprovalStatus = "pending"
+	ApprovalApplied   ApprovalStatus = "applied"
+	ApprovalRejected  ApprovalStatus = "rejected"
+	ApprovalWithdrawn ApprovalStatus = "withdrawn"
+	// ApprovalFailed means the quorum was reached but the publish could not
+	// be applied, e.g. because the dataset changed after the request.
+	ApprovalFailed ApprovalStatus = "failed"
+)
+
+// Quorum is the two-person rule for publishing. Required reviewers, none of
+// them the creator or the requester, must approve. If ReviewerRoles is set,
+// reviewers must hold, directly or by inheritance, one of those roles.
+type Quorum struct {
+	Required      int
+	ReviewerRoles []string
+}
+
+// Review is one reviewer's vote.
+type Review struct {
+	ReviewerID string
+	Comment    string
+	At         time.Time
+}
+
+// ApprovalRequest is a publish waiting for reviewers. Revision is the
+// dataset revision the request was made against; the publish is applied
+// with that revision, so it fails if the dataset changed in between.
+type ApprovalRequest struct {
+	ID        uint64
+	DatasetID string
+	CreatorID string
+	Requester User
+	Revision  uint64
+	Status    ApprovalStatus
+	Approvals []Review
+	Rejection *Review
+	Error     string
+	CreatedAt time.Time
+	ClosedAt  time.Time
+}
+
+// ApprovalWorkflow runs publish requests through a reviewer quorum before
+// applying them to a Repository. The repository should be created with
+// RequireApproval so publishes cannot bypass the workflow.
+type ApprovalWorkflow struct {
+	repo   Repository
+	quorum Quorum
+	policy *Policy
+	clock  Clock
+	opts   []Option
+
+	mu       sync.Mutex
+	nextID   uint64
+	requests map[uint64]*ApprovalRequest
+}
+
+// NewApprovalWorkflow returns a workflow for repo. opts are used for every
+// check the workflow runs and should match the options repo was created
+// with.
+func NewApprovalWorkflow(repo Repository, quorum Quorum, opts ...Option) *ApprovalWorkflow {
+	if quorum.Required < 1 {
+		quorum.Required = 1
+	}
+	// Resolve the options once to learn which policy and clock they select.
+	resolved := newStateTransform("", User{}, DatasetStateInvalid, DatasetActionPublish, opts...)
+	return &ApprovalWorkflow{
+		repo:     repo,
+		quorum:   quorum,
+		policy:   resolved.policy,
+		clock:    resolved.clock,
+		opts:     opts,
+		requests: make(map[uint64]*ApprovalRequest),
+	}
+}
+
+// RequestPublish opens a publish request for the dataset. The requester
+// must be allowed to publish it apart from the approval requirement. The
+// precheck is not journaled; the publish is journaled when the quorum
+// applies it.
+func (w *ApprovalWorkflow) RequestPublish(datasetID string, requester User) (ApprovalRequest, error) {
+	rec, err := w.repo.Get(datasetID)
+	if err != nil {
+		return ApprovalRequest{}, err
+	}
+	if err := w.check(rec, requester).check(); err != nil {
+		return ApprovalRequest{}, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, req := range w.requests {
+		if req.DatasetID == datasetID && req.Status == ApprovalPending {
+			return ApprovalRequest{}, fmt.Errorf("%w: request %d", ErrRequestPending, req.ID)
+		}
+	}
+	w.nextID++
+	req := &ApprovalRequest{
+		ID:        w.nextID,
+		DatasetID: datasetID,
+		CreatorID: rec.CreatorID,
+		Requester: requester,
+		Revision:  rec.Revision,
+		Status:    ApprovalPending,
+		CreatedAt: w.clock.Now(),
+	}
+	w.requests[req.ID] = req
+	return req.snapshot(), nil
+}
+
+// Approve records reviewer's approval. Once the quorum is reached the
+// publish is applied on behalf of the requester and the request is closed
+// as applied, or as failed if the publish no longer goes through.
+func (w *ApprovalWorkflow) Approve(id uint64, reviewer User, comment string) (ApprovalRequest, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	req, err := w.reviewable(id, reviewer)
+	if err != nil {
+		return ApprovalRequest{}, err
+	}
+	req.Approvals = append(req.Approvals, Review{ReviewerID: reviewer.ID, Comment: comment, At: w.clock.Now()})
+	if len(req.Approvals) < w.quorum.Required {
+		return req.snapshot(), nil
+	}
+
+	opts := append(append([]Option(nil), w.opts...), withApproval())
+	_, err = w.repo.Apply(req.DatasetID, req.Revision, req.Requester, DatasetActionPublish, opts...)
+	req.ClosedAt = w.clock.Now()
+	if err != nil {
+		req.Status = ApprovalFailed
+		req.Error = err.Error()
+		return req.snapshot(), err
+	}
+	req.Status = ApprovalApplied
+	return req.snapshot(), nil
+}
+
+// Reject closes the request. A single eligible reviewer can veto a publish.
+func (w *ApprovalWorkflow) Reject(id uint64, reviewer User, comment string) (ApprovalRequest, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	req, err := w.reviewable(id, reviewer)
+	if err != nil {
+		return ApprovalRequest{}, err
+	}
+	now := w.clock.Now()
+	req.Rejection = &Review{ReviewerID: reviewer.ID, Comment: comment, At: now}
+	req.Status = ApprovalRejected
+	req.ClosedAt = now
+	return req.snapshot(), nil
+}
+
+// Withdraw lets the requester close their own pending request.
+func (w *ApprovalWorkflow) Withdraw(id uint64, requester User) (ApprovalRequest, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	req, err := w.open(id)
+	if err != nil {
+		return ApprovalRequest{}, err
+	}
+	if req.Requester.ID != requester.ID {
+		return ApprovalRequest{}, fmt.Errorf("%w: only the requester may withdraw", ErrPermissionDenied)
+	}
+	req.Status = ApprovalWithdrawn
+	req.ClosedAt = w.clock.Now()
+	return req.snapshot(), nil
+}
+
+// Get returns a request by ID.
+func (w *ApprovalWorkflow) Get(id uint64) (ApprovalRequest, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	req, ok := w.requests[id]
+	if !ok {
+		return ApprovalRequest{}, fmt.Errorf("%w: %d", ErrRequestNotFound, id)
+	}
+	return req.snapshot(), nil
+}
+
+// Pending returns every open request, oldest first.
+func (w *ApprovalWorkflow) Pending() []ApprovalRequest {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var pending []ApprovalRequest
+	for _, req := range w.requests {
+		if req.Status == ApprovalPending {
+			pending = append(pending, req.snapshot())
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+	return pending
+}
+
+func (w *ApprovalWorkflow) check(rec DatasetRecord, requester User) *StateTransform {
+	opts := append(append([]Option(nil), w.opts...), withApproval())
+	return newStateTransform(rec.CreatorID, requester, rec.State, DatasetActionPublish, opts...)
+}
+
+func (w *ApprovalWorkflow) open(id uint64) (*ApprovalRequest, error) {
+	req, ok := w.requests[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrRequestNotFound, id)
+	}
+	if req.Status != ApprovalPending {
+		return nil, fmt.Errorf("%w: request %d is %s", ErrRequestClosed, id, req.Status)
+	}
+	return req, nil
+}
+
+// reviewable returns the open request if reviewer may vote on it.
+func (w *ApprovalWorkflow) reviewable(id uint64, reviewer User) (*ApprovalRequest, error) {
+	req, err := w.open(id)
+	if err != nil {
+		return nil, err
+	}
+	if reviewer.ID == req.CreatorID || reviewer.ID == req.Requester.ID {
+		return nil, ErrSelfReview
+	}
+	if !w.eligible(reviewer) {
+		return nil, fmt.Errorf("%w: %s", ErrNotReviewer, reviewer.ID)
+	}
+	for _, review := range req.Approvals {
+		if review.ReviewerID == reviewer.ID {
+			return nil, fmt.Errorf("%w: %s", ErrAlreadyReviewed, reviewer.ID)
+		}
+	}
+	return req, nil
+}
+
+func (w *ApprovalWorkflow) eligible(reviewer User) bool {
+	if len(w.quorum.ReviewerRoles) == 0 {
+		return true
+	}
+	for _, held := range w.policy.ResolveRoles(reviewer.Roles) {
+		for _, role := range w.quorum.ReviewerRoles {
+			if held == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *ApprovalRequest) snapshot() ApprovalRequest {
+	c := *r
+	c.Approvals = append([]Review(nil), r.Approvals...)
+	if r.Rejection != nil {
+		rejection := *r.Rejection
+		c.Rejection = &rejection
+	}
+	return c
+}
@@ -0,0 +1,133 @@
+package state_transform
+
+import (
+	"errors"
+	"testing"
+)
+
+func newApprovalFixture(t *testing.T, quorum Quorum) (*MemoryRepository, *ApprovalWorkflow, User) {
+	t.Helper()
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	repo := NewMemoryRepository(RequireApproval())
+	rec, err := repo.Create("ds", creator.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Apply("ds", rec.Revision, creator, DatasetActionDevelop); err != nil {
+		t.Fatal(err)
+	}
+	return repo, NewApprovalWorkflow(repo, quorum, RequireApproval()), creator
+}
+
+func TestApprovalQuorum(t *testing.T) {
+	repo, w, creator := newApprovalFixture(t, Quorum{Required: 2, ReviewerRoles: []string{"maintainer"}})
+	alice := User{ID: "alice", Roles: []string{"maintainer"}}
+	bob := User{ID: "bob", Roles: []string{"admin"}}
+	dev := User{ID: "dev", Roles: []string{"developer"}}
+
+	rec, _ := repo.Get("ds")
+	if _, err := repo.Apply("ds", rec.Revision, creator, DatasetActionPublish); !errors.Is(err, ErrNeedsApproval) {
+		t.Fatalf("direct publish: expected ErrNeedsApproval, got %v", err)
+	}
+	if _, err := w.RequestPublish("ds", dev); !errors.Is(err, ErrNotCreator) {
+		t.Fatalf("request by non-creator: expected ErrNotCreator, got %v", err)
+	}
+
+	req, err := w.RequestPublish("ds", creator)
+	if err != nil {
+		t.Fatalf("request publish: %v", err)
+	}
+	if _, err := w.RequestPublish("ds", creator); !errors.Is(err, ErrRequestPending) {
+		t.Fatalf("second request: expected ErrRequestPending, got %v", err)
+	}
+	if _, err := w.Approve(req.ID, creator, "lgtm"); !errors.Is(err, ErrSelfReview) {
+		t.Fatalf("self approval: expected ErrSelfReview, got %v", err)
+	}
+	if _, err := w.Approve(req.ID, dev, "lgtm"); !errors.Is(err, ErrNotReviewer) {
+		t.Fatalf("developer approval: expected ErrNotReviewer, got %v", err)
+	}
+
+	req, err = w.Approve(req.ID, alice, "lgtm")
+	if err != nil || req.Status != ApprovalPending {
+		t.Fatalf("first approval: %+v, %v", req, err)
+	}
+	if _, err := w.Approve(req.ID, alice, "again"); !errors.Is(err, ErrAlreadyReviewed) {
+		t.Fatalf("repeat approval: expected ErrAlreadyReviewed, got %v", err)
+	}
+	if rec, _ := repo.Get("ds"); rec.State != DatasetStateDevelopment {
+		t.Fatalf("published before quorum: %s", rec.State)
+	}
+
+	req, err = w.Approve(req.ID, bob, "ship it")
+	if err != nil || req.Status != ApprovalApplied {
+		t.Fatalf("second approval: %+v, %v", req, err)
+	}
+	if rec, _ := repo.Get("ds"); rec.State != DatasetStateReleased {
+		t.Fatalf("expected released, got %s", rec.State)
+	}
+	if _, err := w.Approve(req.ID, User{ID: "carol", Roles: []string{"admin"}}, ""); !errors.Is(err, ErrRequestClosed) {
+		t.Fatalf("approval after close: expected ErrRequestClosed, got %v", err)
+	}
+}
+
+func TestApprovalRejectionPaths(t *testing.T) {
+	repo, w, creator := newApprovalFixture(t, Quorum{Required: 1})
+	reviewer := User{ID: "reviewer", Roles: []string{"developer"}}
+
+	req, _ := w.RequestPublish("ds", creator)
+	req, err := w.Reject(req.ID, reviewer, "missing data card")
+	if err != nil || req.Status != ApprovalRejected || req.Rejection.ReviewerID != "reviewer" {
+		t.Fatalf("reject: %+v, %v", req, err)
+	}
+
+	req, _ = w.RequestPublish("ds", creator)
+	if _, err := w.Withdraw(req.ID, reviewer); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("withdraw by reviewer: expected ErrPermissionDenied, got %v", err)
+	}
+	if req, err = w.Withdraw(req.ID, creator); err != nil || req.Status != ApprovalWithdrawn {
+		t.Fatalf("withdraw: %+v, %v", req, err)
+	}
+
+	// The dataset changes while the request is pending: the approval fails.
+	req, _ = w.RequestPublish("ds", creator)
+	rec, _ := repo.Get("ds")
+	if _, err := repo.Apply("ds", rec.Revision, creator, DatasetActionOutdate); err != nil {
+		t.Fatal(err)
+	}
+	req, err = w.Approve(req.ID, reviewer, "lgtm")
+	if !errors.Is(err, ErrConflict) || req.Status != ApprovalFailed {
+		t.Fatalf("stale approval: %+v, %v", req, err)
+	}
+	if len(w.Pending()) != 0 {
+		t.Fatalf("expected no pending requests, got %+v", w.Pending())
+	}
+}
+
+func TestApprovalJournalsOnlyTheAppliedPublish(t *testing.T) {
+	journal := NewJournal(nil)
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	repo := NewMemoryRepository(RequireApproval(), WithJournal(journal))
+	rec, _ := repo.Create("ds", creator.ID)
+	if _, err := repo.Apply("ds", rec.Revision, creator, DatasetActionDevelop); err != nil {
+		t.Fatal(err)
+	}
+	w := NewApprovalWorkflow(repo, Quorum{Required: 1}, RequireApproval(), WithJournal(journal))
+
+	req, err := w.RequestPublish("ds", creator)
+	if err != nil {
+		t.Fatalf("request publish: %v", err)
+	}
+	if n := len(journal.Entries()); n != 1 {
+		t.Fatalf("expected only the develop entry after the request, got %d entries", n)
+	}
+	if _, err := w.Approve(req.ID, User{ID: "alice"}, "lgtm"); err != nil {
+		t.Fatalf("approve: %v", err)
+	}
+	entries := journal.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if e := entries[1]; e.Action != DatasetActionPublish || e.Outcome != OutcomeAllowed || e.To != DatasetStateReleased {
+		t.Fatalf("unexpected publish entry %+v", e)
+	}
+}
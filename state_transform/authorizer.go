@@ -0,0 +1,128 @@
+package state_transform
+
+import "sync"
+
+// DatasetRef is what the policy needs to know about one dataset of a
+// listing.
+type DatasetRef struct {
+	ID        string
+	CreatorID string
+	State     DatasetState
+}
+
+// Authorization lists the actions the operator may perform on one dataset.
+type Authorization struct {
+	DatasetRef
+	Actions []DatasetAction
+}
+
+// Authorizer answers Check for one operator and many datasets. Decisions
+// only depend on the dataset through its state and whether the operator
+// created it, so the Authorizer evaluates the policy once per state and
+// action for each of the two relationships and then answers every record
+// from those tables. Policies whose conditions read creatorID get one table
+// per creator instead.
+//
+// The options given to NewAuthorizer apply to every dataset; per-dataset
+// settings such as grants, embargoes, tenants or the tombstone a restore
+// needs call for an Authorizer of their own or a plain StateTransform.
+// Tables are computed once, so time-bound rules are judged at first use; an
+// Authorizer is meant to serve a listing, not to live for long. Decisions
+// are not journaled. An Authorizer is safe for concurrent use.
+type Authorizer struct {
+	operator   User
+	opts       []Option
+	perCreator bool
+
+	mu     sync.Mutex
+	tables map[tableKey]*decisionTable
+}
+
+type tableKey struct {
+	creator   bool
+	creatorID string
+}
+
+type decisionTable [datasetStateCount][datasetActionCount]bool
+
+// NewAuthorizer returns an Authorizer for operator. opts are passed to every
+// StateTransform it evaluates.
+func NewAuthorizer(operator User, opts ...Option) *Authorizer {
+	s := newStateTransform("", operator, DatasetStateInvalid, DatasetActionRead, opts...)
+	a := &Authorizer{operator: operator, opts: opts, tables: make(map[tableKey]*decisionTable)}
+	for _, c := range s.policy.conditions {
+		if c.when.uses("creatorID") {
+			a.perCreator = true
+		}
+	}
+	return a
+}
+
+// Allowed reports whether the operator may apply action to the dataset.
+// Invalid states and actions are denied.
+func (a *Authorizer) Allowed(ref DatasetRef, action DatasetAction) bool {
+	if !ref.State.Valid() || !action.Valid() {
+		return false
+	}
+	return a.table(ref.CreatorID)[ref.State][action]
+}
+
+// Actions returns the actions the operator may apply to the dataset in
+// ascending order.
+func (a *Authorizer) Actions(ref DatasetRef) []DatasetAction {
+	if !ref.State.Valid() {
+		return nil
+	}
+	row := a.table(ref.CreatorID)[ref.State]
+	var actions []DatasetAction
+	for _, action := range AllDatasetActions() {
+		if row[action] {
+			actions = append(actions, action)
+		}
+	}
+	return actions
+}
+
+// Authorize returns the permitted actions for every record, in the order
+// given.
+func (a *Authorizer) Authorize(refs []DatasetRef) []Authorization {
+	auths := make([]Authorization, len(refs))
+	for i, ref := range refs {
+		auths[i] = Authorization{DatasetRef: ref, Actions: a.Actions(ref)}
+	}
+	return auths
+}
+
+// Filter returns the records that allow action, keeping their order.
+func (a *Authorizer) Filter(refs []DatasetRef, action DatasetAction) []DatasetRef {
+	var allowed []DatasetRef
+	for _, ref := range refs {
+		if a.Allowed(ref, action) {
+			allowed = append(allowed, ref)
+		}
+	}
+	return allowed
+}
+
+// table returns the decision table for datasets created by creatorID,
+// computing it on first use.
+func (a *Authorizer) table(creatorID string) *decisionTable {
+	key := tableKey{creator: creatorID != "" && creatorID == a.operator.ID}
+	if a.perCreator {
+		key.creatorID = creatorID
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if t, ok := a.tables[key]; ok {
+		return t
+	}
+	t := new(decisionTable)
+	for _, state := range AllDatasetStates() {
+		for _, action := range AllDatasetActions() {
+			t[state][action] = newStateTransform(creatorID, a.operator, state, action, a.opts...).check() == nil
+		}
+	}
+	a.tables[key] = t
+	return t
+}
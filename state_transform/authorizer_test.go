@@ -0,0 +1,91 @@
+package state_transform
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// listing returns n datasets cycling through every state and a few creators.
+func listing(n int) []DatasetRef {
+	creators := []string{"creator", "alice", "bob", ""}
+	refs := make([]DatasetRef, n)
+	for i := range refs {
+		refs[i] = DatasetRef{
+			ID:        fmt.Sprintf("ds-%d", i),
+			CreatorID: creators[i%len(creators)],
+			State:     DatasetState(i % datasetStateCount),
+		}
+	}
+	return refs
+}
+
+func TestAuthorizerMatchesCheck(t *testing.T) {
+	p, err := ParsePolicy([]byte(`{"subjects": {"auditor": ` + auditorRow + `}, "conditions": [{"effect": "allow", "when": "creatorID == \"alice\" && action == Read"}]}`))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	operators := []User{
+		{ID: "creator", Roles: []string{"developer"}},
+		{ID: "alice", Roles: []string{"viewer"}},
+		{ID: "admin", Roles: []string{"admin"}},
+		{ID: "guest"},
+	}
+	refs := listing(200)
+	for _, opts := range [][]Option{nil, {WithPolicy(p)}} {
+		for _, operator := range operators {
+			a := NewAuthorizer(operator, opts...)
+			for _, auth := range a.Authorize(refs) {
+				var want []DatasetAction
+				for _, action := range AllDatasetActions() {
+					if NewStateTransform(auth.CreatorID, operator, auth.State, action, opts...).Check() == nil {
+						want = append(want, action)
+					}
+				}
+				if !slices.Equal(auth.Actions, want) {
+					t.Fatalf("%s on %+v: expected %v, got %v", operator.ID, auth.DatasetRef, want, auth.Actions)
+				}
+			}
+		}
+	}
+	if !NewAuthorizer(User{ID: "bob"}, WithPolicy(p)).perCreator || NewAuthorizer(User{ID: "bob"}).perCreator {
+		t.Fatal("expected per-creator tables only for policies reading creatorID")
+	}
+}
+
+func TestAuthorizerFilter(t *testing.T) {
+	a := NewAuthorizer(User{ID: "creator", Roles: []string{"developer"}})
+	refs := []DatasetRef{
+		{ID: "mine", CreatorID: "creator", State: DatasetStateDevelopment},
+		{ID: "theirs", CreatorID: "alice", State: DatasetStateDevelopment},
+		{ID: "banned", CreatorID: "creator", State: DatasetStateBanned},
+		{ID: "broken", CreatorID: "creator", State: DatasetState(42)},
+	}
+	got := a.Filter(refs, DatasetActionPublish)
+	if len(got) != 1 || got[0].ID != "mine" {
+		t.Fatalf("unexpected filter result %+v", got)
+	}
+	if a.Actions(refs[3]) != nil || a.Allowed(refs[0], DatasetAction(42)) {
+		t.Fatal("invalid states and actions must be denied")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.Filter(listing(100), DatasetActionRead)
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkAuthorizerFilter(b *testing.B) {
+	operator := User{ID: "creator", Roles: []string{"developer"}}
+	refs := listing(5000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewAuthorizer(operator).Filter(refs, DatasetActionRead)
+	}
+}
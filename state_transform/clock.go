@@ -0,0 +1,54 @@
+package state_transform
+
+import "time"
+
+// Clock tells StateTransform and Scheduler what time it is.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SystemClock is the wall clock. It is the default for every component that
+// takes a Clock.
+var SystemClock Clock = systemClock{}
+
+// fixedClock always reports the same instant.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// WithClock makes time-bound rules and journal timestamps use c.
+func WithClock(c Clock) Option {
+	return func(s *StateTransform) {
+		if c != nil {
+			s.clock = c
+		}
+	}
+}
+
+// WithEmbargo denies DatasetActionPublish until the given instant, even for
+// operators the policy otherwise allows.
+func WithEmbargo(until time.Time) Option {
+	return func(s *StateTransform) {
+		s.embargo = until
+	}
+}
+
+// withStoredEmbargo applies an embargo kept on a dataset record. It only
+// ever moves the embargo later, so an option passed for one call cannot
+// shorten it.
+func withStoredEmbargo(until time.Time) Option {
+	return func(s *StateTransform) {
+		if until.After(s.embargo) {
+			s.embargo = until
+		}
+	}
+}
+
+// embargoed reports whether the action is blocked by the embargo.
+func (s *StateTransform) embargoed() bool {
+	return s.action == DatasetActionPublish && !s.embargo.IsZero() && s.clock.Now().Before(s.embargo)
+}
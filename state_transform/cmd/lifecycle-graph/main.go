@@ -0,0 +1,47 @@
+// Command lifecycle-graph renders the dataset lifecycle allowed by a policy
+// for one operator relationship, as Graphviz DOT or Mermaid. Only the
+// policy's allow and deny tables are drawn; its conditions are listed as
+// comments in the output and on stderr.
+//
+//	lifecycle-graph -subjects creator -format mermaid
+//	lifecycle-graph -policy policy.json -subjects developer | dot -Tsvg
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	st "code-agent-challenges/state_stransform"
+)
+
+func main() {
+	policyPath := flag.String("policy", "", "JSON policy file (defaults to the built-in policy)")
+	subjects := flag.String("subjects", st.SubjectCreator, "comma-separated policy subjects the operator matches, e.g. creator or admin or developer")
+	format := flag.String("format", "dot", "output format: dot or mermaid")
+	flag.Parse()
+
+	policy := st.DefaultPolicy()
+	if *policyPath != "" {
+		p, err := st.LoadPolicy(*policyPath)
+		if err != nil {
+			log.Fatalf("load policy: %v", err)
+		}
+		policy = p
+	}
+
+	g := policy.Graph(strings.Split(*subjects, ",")...)
+	for _, c := range g.Conditions {
+		fmt.Fprintf(os.Stderr, "lifecycle-graph: condition not reflected in the graph: %s\n", c)
+	}
+	switch *format {
+	case "dot":
+		fmt.Fprint(os.Stdout, g.DOT())
+	case "mermaid":
+		fmt.Fprint(os.Stdout, g.Mermaid())
+	default:
+		log.Fatalf("unknown format %q", *format)
+	}
+}
@@ -0,0 +1,75 @@
+// Command policy-diff compares two lifecycle policies and lists every
+// decision that flipped between allow and deny, grouped by risk.
+//
+//	policy-diff new.json                 compare against the built-in policy
+//	policy-diff -old old.json new.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	st "code-agent-challenges/state_stransform"
+)
+
+func main() {
+	oldPath := flag.String("old", "", "JSON policy file to compare against (defaults to the built-in policy)")
+	failOn := flag.String("fail-on", "", "exit with status 1 if a change of this risk or higher is found: low, medium or high")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: policy-diff [-old old.json] [-fail-on risk] new.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	threshold := st.Risk(-1)
+	if *failOn != "" {
+		threshold = parseRisk(*failOn)
+	}
+
+	from := st.DefaultPolicy()
+	if *oldPath != "" {
+		p, err := st.LoadPolicy(*oldPath)
+		if err != nil {
+			log.Fatalf("load old policy: %v", err)
+		}
+		from = p
+	}
+	to, err := st.LoadPolicy(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("load new policy: %v", err)
+	}
+
+	changes := st.DiffPolicies(from, to)
+	if len(changes) == 0 {
+		fmt.Println("no decisions changed")
+		return
+	}
+	for i, c := range changes {
+		if i == 0 || changes[i-1].Risk != c.Risk {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s risk:\n", c.Risk)
+		}
+		fmt.Printf("  %s\n", c)
+	}
+	if threshold >= 0 && changes[0].Risk >= threshold {
+		os.Exit(1)
+	}
+}
+
+func parseRisk(name string) st.Risk {
+	for _, r := range []st.Risk{st.RiskLow, st.RiskMedium, st.RiskHigh} {
+		if r.String() == name {
+			return r
+		}
+	}
+	log.Fatalf("unknown risk %q", name)
+	return 0
+}
@@ -0,0 +1,50 @@
+// Command policy-verify checks a lifecycle policy against the built-in
+// invariants by enumerating every operator profile, state and action, and
+// prints a counterexample for each violation. It exits with status 1 when
+// any invariant is violated, so it can gate policy changes in CI.
+//
+//	policy-verify -policy policy.json
+//	policy-verify -list
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	st "code-agent-challenges/state_stransform"
+)
+
+func main() {
+	policyPath := flag.String("policy", "", "JSON policy file (defaults to the built-in policy)")
+	list := flag.Bool("list", false, "list the invariants and exit")
+	flag.Parse()
+
+	invariants := st.DefaultInvariants()
+	if *list {
+		for _, inv := range invariants {
+			fmt.Printf("%-26s %s\n", inv.Name, inv.Description)
+		}
+		return
+	}
+
+	policy := st.DefaultPolicy()
+	if *policyPath != "" {
+		p, err := st.LoadPolicy(*policyPath)
+		if err != nil {
+			log.Fatalf("load policy: %v", err)
+		}
+		policy = p
+	}
+
+	violations := policy.Verify(invariants...)
+	for _, v := range violations {
+		fmt.Println(v)
+	}
+	if len(violations) > 0 {
+		fmt.Fprintf(os.Stderr, "%d violations\n", len(violations))
+		os.Exit(1)
+	}
+	fmt.Printf("%d invariants hold\n", len(invariants))
+}
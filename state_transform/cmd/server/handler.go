@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	st "code-agent-challenges/state_stransform"
+)
+
+const (
+	maxBatchSize = 1000
+	maxBodyBytes = 4 << 20
+)
+
+type operatorDTO struct {
+	ID     string   `json:"id"`
+	Roles  []string `json:"roles"`
+	Groups []string `json:"groups"`
+	Tenant string   `json:"tenant"`
+}
+
+type decisionRequest struct {
+	CreatorID string      `json:"creator_id"`
+	Operator  operatorDTO `json:"operator"`
+	State     string      `json:"state"`
+	Action    string      `json:"action"`
+	Grants    []st.Grant  `json:"grants"`
+	Tenant    string      `json:"tenant"`
+	Public    bool        `json:"public"`
+}
+
+type decisionResponse struct {
+	Allowed   bool   `json:"allowed"`
+	NextState string `json:"next_state,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+type batchRequest struct {
+	Requests []decisionRequest `json:"requests"`
+}
+
+type batchResponse struct {
+	Decisions []decisionResponse `json:"decisions"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// reasonInvalidRequest marks decisions whose state or action could not be
+// parsed.
+const reasonInvalidRequest = "invalid_request"
+
+type handler struct {
+	policy *st.Policy
+}
+
+func newHandler(policy *st.Policy) http.Handler {
+	h := &handler{policy: policy}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/decisions", h.decide)
+	mux.HandleFunc("POST /v1/decisions/batch", h.decideBatch)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	return mux
+}
+
+func (h *handler) decide(w http.ResponseWriter, r *http.Request) {
+	var req decisionRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	resp := h.evaluate(req)
+	if resp.Reason == reasonInvalidRequest {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: resp.Message})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) decideBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchRequest
+	if err := decodeBody(w, r, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if len(req.Requests) > maxBatchSize {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("batch exceeds %d requests", maxBatchSize)})
+		return
+	}
+	resp := batchResponse{Decisions: make([]decisionResponse, len(req.Requests))}
+	for i, item := range req.Requests {
+		resp.Decisions[i] = h.evaluate(item)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *handler) evaluate(req decisionRequest) decisionResponse {
+	state, err := st.ParseDatasetState(req.State)
+	if err != nil {
+		return decisionResponse{Reason: reasonInvalidRequest, Message: err.Error()}
+	}
+	action, err := st.ParseDatasetAction(req.Action)
+	if err != nil {
+		return decisionResponse{Reason: reasonInvalidRequest, Message: err.Error()}
+	}
+
+	operator := st.User{ID: req.Operator.ID, Roles: req.Operator.Roles, Groups: req.Operator.Groups, Tenant: req.Operator.Tenant}
+	next, err := st.NewStateTransform(req.CreatorID, operator, state, action,
+		st.WithPolicy(h.policy),
+		st.WithGrants(req.Grants...),
+		st.WithTenant(req.Tenant),
+		st.WithPublic(req.Public),
+	).Transition()
+	if err != nil {
+		var denial *st.DenialError
+		if errors.As(err, &denial) {
+			return decisionResponse{Reason: string(denial.Reason), Message: err.Error()}
+		}
+		return decisionResponse{Reason: reasonInvalidRequest, Message: err.Error()}
+	}
+	return decisionResponse{Allowed: true, NextState: next.String()}
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
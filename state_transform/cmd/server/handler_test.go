@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	st "code-agent-challenges/state_stransform"
+)
+
+func TestDecide(t *testing.T) {
+	srv := httptest.NewServer(newHandler(st.DefaultPolicy()))
+	defer srv.Close()
+
+	tests := []struct {
+		body   string
+		status int
+		want   decisionResponse
+	}{
+		{
+			`{"creator_id": "alice", "operator": {"id": "alice", "roles": ["developer"]}, "state": "development", "action": "publish"}`,
+			http.StatusOK,
+			decisionResponse{Allowed: true, NextState: "released"},
+		},
+		{
+			`{"creator_id": "alice", "operator": {"id": "bob", "roles": ["developer"]}, "state": "development", "action": "publish"}`,
+			http.StatusOK,
+			decisionResponse{Reason: string(st.ReasonNotCreator)},
+		},
+		{
+			`{"creator_id": "alice", "operator": {"id": "bob"}, "state": "archived", "action": "publish"}`,
+			http.StatusBadRequest,
+			decisionResponse{},
+		},
+		{
+			`{"creator_id": "alice", "operator": {"id": "erin", "groups": ["readers"]}, "state": "development", "action": "read", "grants": [{"group": "readers", "level": "reader"}]}`,
+			http.StatusOK,
+			decisionResponse{Allowed: true, NextState: "development"},
+		},
+		{
+			`{"creator_id": "alice", "operator": {"id": "mallory", "roles": ["admin"], "tenant": "globex"}, "state": "released", "action": "ban", "tenant": "acme"}`,
+			http.StatusOK,
+			decisionResponse{Reason: string(st.ReasonCrossTenant)},
+		},
+		{`{"creator_id": 1}`, http.StatusBadRequest, decisionResponse{}},
+	}
+	for i, test := range tests {
+		resp, err := http.Post(srv.URL+"/v1/decisions", "application/json", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got decisionResponse
+		json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Fatalf("test %d: expected status %d, got %d", i, test.status, resp.StatusCode)
+		}
+		if test.status == http.StatusOK && (got.Allowed != test.want.Allowed || got.NextState != test.want.NextState || got.Reason != test.want.Reason) {
+			t.Fatalf("test %d: expected %+v, got %+v", i, test.want, got)
+		}
+	}
+}
+
+func TestDecideBatch(t *testing.T) {
+	srv := httptest.NewServer(newHandler(st.DefaultPolicy()))
+	defer srv.Close()
+
+	body := `{"requests": [
+		{"creator_id": "alice", "operator": {"id": "root", "roles": ["admin"]}, "state": "released", "action": "ban"},
+		{"creator_id": "alice", "operator": {"id": "bob", "roles": ["developer"]}, "state": "banned", "action": "read"},
+		{"creator_id": "alice", "operator": {"id": "bob"}, "state": "released", "action": "fly"}
+	]}`
+	resp, err := http.Post(srv.URL+"/v1/decisions/batch", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	var got batchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Decisions) != 3 {
+		t.Fatalf("expected 3 decisions, got %d", len(got.Decisions))
+	}
+	if d := got.Decisions[0]; !d.Allowed || d.NextState != "banned" {
+		t.Fatalf("decision 0: unexpected %+v", d)
+	}
+	if d := got.Decisions[1]; d.Allowed || d.Reason != string(st.ReasonDatasetBanned) {
+		t.Fatalf("decision 1: unexpected %+v", d)
+	}
+	if d := got.Decisions[2]; d.Allowed || d.Reason != reasonInvalidRequest {
+		t.Fatalf("decision 2: unexpected %+v", d)
+	}
+}
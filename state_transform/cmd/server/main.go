@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	st "code-agent-challenges/state_stransform"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	policyPath := flag.String("policy", "", "JSON policy file (defaults to the built-in policy)")
+	flag.Parse()
+
+	policy := st.DefaultPolicy()
+	if *policyPath != "" {
+		p, err := st.LoadPolicy(*policyPath)
+		if err != nil {
+			log.Fatalf("load policy: %v", err)
+		}
+		policy = p
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           newHandler(policy),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		log.Printf("policy decision service listening on %s", *addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("listen: %v", err)
+		}
+	}()
+
+	// Wait for interrupt signal
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+}
@@ -0,0 +1,433 @@
+package state_transform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Condition is a compiled boolean expression over a single decision. It is
+// parsed once with CompileCondition and is safe for concurrent use.
+//
+// The language has string literals ("auditor"), the booleans true and false,
+// the state and action names (Banned, Released, Read, Publish, ...; case
+// does not matter) and these variables:
+//
+//	operator.id      string
+//	operator.roles   list of strings
+//	operator.groups  list of strings
+//	operator.tenant  string
+//	creatorID        string
+//	state            dataset state
+//	action           dataset action
+//
+// Operators, from lowest to highest precedence: ||, &&, !, and the
+// comparisons ==, != and in (string in list). Parentheses group. Operands
+// are type checked at compile time; there are no function calls, loops or
+// side effects.
+type Condition struct {
+	src  string
+	eval func(*conditionEnv) value
+	vars map[string]bool
+}
+
+type conditionEnv struct {
+	operator  *User
+	creatorID string
+	state     DatasetState
+	action    DatasetAction
+}
+
+type valueKind int
+
+const (
+	kindBool valueKind = iota
+	kindString
+	kindList
+	kindState
+	kindAction
+)
+
+var kindNames = [...]string{
+	kindBool:   "bool",
+	kindString: "string",
+	kindList:   "list",
+	kindState:  "state",
+	kindAction: "action",
+}
+
+func (k valueKind) String() string { return kindNames[k] }
+
+type value struct {
+	b    bool
+	n    int
+	s    string
+	list []string
+}
+
+type node struct {
+	kind valueKind
+	eval func(*conditionEnv) value
+}
+
+// ConditionError is a compile error with the offset, in runes, where it
+// occurred.
+type ConditionError struct {
+	Src string
+	Pos int
+	Msg string
+}
+
+func (e *ConditionError) Error() string {
+	return fmt.Sprintf("condition %q: column %d: %s", e.Src, e.Pos+1, e.Msg)
+}
+
+// CompileCondition parses and type checks src.
+func CompileCondition(src string) (*Condition, error) {
+	tokens, err := lexCondition(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &conditionParser{src: src, tokens: tokens, vars: make(map[string]bool)}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorf(tok, "unexpected %s", tok)
+	}
+	if n.kind != kindBool {
+		return nil, &ConditionError{Src: src, Pos: 0, Msg: fmt.Sprintf("condition is a %s, not a bool", n.kind)}
+	}
+	return &Condition{src: src, eval: n.eval, vars: p.vars}, nil
+}
+
+// MustCompileCondition is like CompileCondition but panics on error.
+func MustCompileCondition(src string) *Condition {
+	c, err := CompileCondition(src)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// String returns the source the condition was compiled from.
+func (c *Condition) String() string {
+	return c.src
+}
+
+// Eval evaluates the condition for one decision.
+func (c *Condition) Eval(creatorID string, operator User, state DatasetState, action DatasetAction) bool {
+	return c.eval(&conditionEnv{operator: &operator, creatorID: creatorID, state: state, action: action}).b
+}
+
+// uses reports whether the condition reads the variable name.
+func (c *Condition) uses(name string) bool {
+	return c.vars[name]
+}
+
+func (c *Condition) evalFor(s *StateTransform) bool {
+	return c.eval(&conditionEnv{operator: &s.operator, creatorID: s.creatorID, state: s.state, action: s.action}).b
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokEq
+	tokNeq
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	pos  int
+	text string
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of condition"
+	case tokString:
+		return "string " + strconv.Quote(t.text)
+	default:
+		return strconv.Quote(t.text)
+	}
+}
+
+var conditionOperators = []struct {
+	text string
+	kind tokenKind
+}{
+	{"==", tokEq},
+	{"!=", tokNeq},
+	{"&&", tokAnd},
+	{"||", tokOr},
+	{"!", tokNot},
+	{"(", tokLParen},
+	{")", tokRParen},
+}
+
+func lexCondition(src string) ([]token, error) {
+	// i is a byte offset into src; positions are reported in runes.
+	col := func(i int) int { return utf8.RuneCountInString(src[:i]) }
+	var tokens []token
+	i := 0
+next:
+	for i < len(src) {
+		c, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+			continue
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, &ConditionError{Src: src, Pos: col(i), Msg: "unterminated string"}
+			}
+			text, err := strconv.Unquote(src[i : end+1])
+			if err != nil {
+				return nil, &ConditionError{Src: src, Pos: col(i), Msg: "invalid string literal"}
+			}
+			tokens = append(tokens, token{kind: tokString, pos: col(i), text: text})
+			i = end + 1
+			continue
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(src) {
+				c, size := utf8.DecodeRuneInString(src[i:])
+				if c != '_' && c != '.' && !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, token{kind: tokIdent, pos: col(start), text: src[start:i]})
+			continue
+		}
+		for _, op := range conditionOperators {
+			if strings.HasPrefix(src[i:], op.text) {
+				tokens = append(tokens, token{kind: op.kind, pos: col(i), text: op.text})
+				i += len(op.text)
+				continue next
+			}
+		}
+		return nil, &ConditionError{Src: src, Pos: col(i), Msg: fmt.Sprintf("unexpected character %q", c)}
+	}
+	return append(tokens, token{kind: tokEOF, pos: col(len(src))}), nil
+}
+
+type conditionParser struct {
+	src    string
+	tokens []token
+	pos    int
+	vars   map[string]bool
+}
+
+func (p *conditionParser) peek() token { return p.tokens[p.pos] }
+
+func (p *conditionParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *conditionParser) errorf(tok token, format string, args ...any) error {
+	return &ConditionError{Src: p.src, Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *conditionParser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return node{}, err
+	}
+	for p.peek().kind == tokOr {
+		op := p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return node{}, err
+		}
+		if err := p.expectBools(op, left, right); err != nil {
+			return node{}, err
+		}
+		l, r := left.eval, right.eval
+		left = node{kind: kindBool, eval: func(env *conditionEnv) value {
+			return value{b: l(env).b || r(env).b}
+		}}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return node{}, err
+	}
+	for p.peek().kind == tokAnd {
+		op := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return node{}, err
+		}
+		if err := p.expectBools(op, left, right); err != nil {
+			return node{}, err
+		}
+		l, r := left.eval, right.eval
+		left = node{kind: kindBool, eval: func(env *conditionEnv) value {
+			return value{b: l(env).b && r(env).b}
+		}}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseUnary() (node, error) {
+	if p.peek().kind != tokNot {
+		return p.parseComparison()
+	}
+	op := p.next()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return node{}, err
+	}
+	if operand.kind != kindBool {
+		return node{}, p.errorf(op, "! needs a bool, not a %s", operand.kind)
+	}
+	inner := operand.eval
+	return node{kind: kindBool, eval: func(env *conditionEnv) value {
+		return value{b: !inner(env).b}
+	}}, nil
+}
+
+func (p *conditionParser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return node{}, err
+	}
+	op := p.peek()
+	switch {
+	case op.kind == tokEq || op.kind == tokNeq:
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return node{}, err
+		}
+		if left.kind != right.kind || left.kind == kindList {
+			return node{}, p.errorf(op, "cannot compare %s with %s", left.kind, right.kind)
+		}
+		eq := equalValues(left, right)
+		if op.kind == tokNeq {
+			return node{kind: kindBool, eval: func(env *conditionEnv) value {
+				return value{b: !eq(env)}
+			}}, nil
+		}
+		return node{kind: kindBool, eval: func(env *conditionEnv) value {
+			return value{b: eq(env)}
+		}}, nil
+	case op.kind == tokIdent && op.text == "in":
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return node{}, err
+		}
+		if left.kind != kindString || right.kind != kindList {
+			return node{}, p.errorf(op, "in needs a string and a list, not %s and %s", left.kind, right.kind)
+		}
+		l, r := left.eval, right.eval
+		return node{kind: kindBool, eval: func(env *conditionEnv) value {
+			needle := l(env).s
+			for _, s := range r(env).list {
+				if s == needle {
+					return value{b: true}
+				}
+			}
+			return value{}
+		}}, nil
+	}
+	return left, nil
+}
+
+func equalValues(left, right node) func(*conditionEnv) bool {
+	l, r := left.eval, right.eval
+	switch left.kind {
+	case kindString:
+		return func(env *conditionEnv) bool { return l(env).s == r(env).s }
+	case kindBool:
+		return func(env *conditionEnv) bool { return l(env).b == r(env).b }
+	default:
+		return func(env *conditionEnv) bool { return l(env).n == r(env).n }
+	}
+}
+
+func (p *conditionParser) expectBools(op token, left, right node) error {
+	if left.kind != kindBool || right.kind != kindBool {
+		return p.errorf(op, "%s needs bools, not %s and %s", op.text, left.kind, right.kind)
+	}
+	return nil
+}
+
+var conditionVariables = map[string]node{
+	"operator.id":     {kindString, func(env *conditionEnv) value { return value{s: env.operator.ID} }},
+	"operator.roles":  {kindList, func(env *conditionEnv) value { return value{list: env.operator.Roles} }},
+	"operator.groups": {kindList, func(env *conditionEnv) value { return value{list: env.operator.Groups} }},
+	"operator.tenant": {kindString, func(env *conditionEnv) value { return value{s: env.operator.Tenant} }},
+	"creatorID":       {kindString, func(env *conditionEnv) value { return value{s: env.creatorID} }},
+	"state":           {kindState, func(env *conditionEnv) value { return value{n: int(env.state)} }},
+	"action":          {kindAction, func(env *conditionEnv) value { return value{n: int(env.action)} }},
+}
+
+func constant(kind valueKind, v value) node {
+	return node{kind: kind, eval: func(*conditionEnv) value { return v }}
+}
+
+func (p *conditionParser) parseOperand() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return constant(kindString, value{s: tok.text}), nil
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return node{}, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return node{}, p.errorf(closing, "expected \")\", found %s", closing)
+		}
+		return inner, nil
+	case tokIdent:
+		if n, ok := conditionVariables[tok.text]; ok {
+			p.vars[tok.text] = true
+			return n, nil
+		}
+		name := strings.ToLower(tok.text)
+		switch name {
+		case "true":
+			return constant(kindBool, value{b: true}), nil
+		case "false":
+			return constant(kindBool, value{}), nil
+		}
+		if state, err := ParseDatasetState(name); err == nil {
+			return constant(kindState, value{n: int(state)}), nil
+		}
+		if action, err := ParseDatasetAction(name); err == nil {
+			return constant(kindAction, value{n: int(action)}), nil
+		}
+		return node{}, p.errorf(tok, "unknown identifier %s", tok)
+	}
+	return node{}, p.errorf(tok, "unexpected %s", tok)
+}
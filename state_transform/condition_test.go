@@ -0,0 +1,120 @@
+package state_transform
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConditionEval(t *testing.T) {
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	auditor := User{ID: "audrey", Roles: []string{"auditor"}, Groups: []string{"compliance"}}
+
+	tests := []struct {
+		src      string
+		operator User
+		state    DatasetState
+		action   DatasetAction
+		want     bool
+	}{
+		{`operator.id == creatorID && state != Banned`, creator, DatasetStateReleased, DatasetActionRead, true},
+		{`operator.id == creatorID && state != Banned`, creator, DatasetStateBanned, DatasetActionRead, false},
+		{`operator.id == creatorID && state != Banned`, auditor, DatasetStateReleased, DatasetActionRead, false},
+		{`"auditor" in operator.roles && action == Read`, auditor, DatasetStateBanned, DatasetActionRead, true},
+		{`"auditor" in operator.roles && action == Read`, auditor, DatasetStateBanned, DatasetActionExec, false},
+		{`!("compliance" in operator.groups) || state == released`, auditor, DatasetStateReleased, DatasetActionExec, true},
+		{`!("compliance" in operator.groups) || state == released`, auditor, DatasetStateOutdated, DatasetActionExec, false},
+		{`action == Publish || action == Outdate && false`, creator, DatasetStateReleased, DatasetActionPublish, true},
+		{`(action == Publish || action == Outdate) && false`, creator, DatasetStateReleased, DatasetActionPublish, false},
+		{`operator.id != "x\"y"`, creator, DatasetStateReleased, DatasetActionRead, true},
+	}
+	for _, test := range tests {
+		c, err := CompileCondition(test.src)
+		if err != nil {
+			t.Fatalf("compile %q: %v", test.src, err)
+		}
+		if got := c.Eval("creator", test.operator, test.state, test.action); got != test.want {
+			t.Fatalf("%q for %s %s on %s: expected %v, got %v", test.src, test.operator.ID, test.action, test.state, test.want, got)
+		}
+	}
+}
+
+func TestConditionCompileErrors(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantErr string
+		pos     int
+	}{
+		{`state == Read`, "cannot compare state with action", 6},
+		{`operator.roles == "admin"`, "cannot compare list with string", 15},
+		{`operator.name == "x"`, `unknown identifier "operator.name"`, 0},
+		{`state == Banned &&`, "unexpected end of condition", 18},
+		{`(state == Banned`, `expected ")"`, 16},
+		{`operator.id`, "condition is a string, not a bool", 0},
+		{`"a" in "b"`, "in needs a string and a list", 4},
+		{`state == Banned & true`, "unexpected character '&'", 16},
+		{`operator.id == "open`, "unterminated string", 15},
+		{`!state`, "! needs a bool", 0},
+		{`state == Banned state`, `unexpected "state"`, 16},
+		{`opérateur == "x"`, `unknown identifier "opérateur"`, 0},
+		{`"é" in operator.roles && état`, `unknown identifier "état"`, 25},
+		{`"é" == "é" § true`, "unexpected character '§'", 11},
+	}
+	for _, test := range tests {
+		_, err := CompileCondition(test.src)
+		var condErr *ConditionError
+		if !errors.As(err, &condErr) {
+			t.Fatalf("%q: expected *ConditionError, got %v", test.src, err)
+		}
+		if !strings.Contains(err.Error(), test.wantErr) || condErr.Pos != test.pos {
+			t.Fatalf("%q: expected %q at %d, got %v at %d", test.src, test.wantErr, test.pos, err, condErr.Pos)
+		}
+	}
+}
+
+func TestPolicyConditions(t *testing.T) {
+	base, err := DefaultPolicy().MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := strings.TrimSuffix(string(base), "}") + `,"conditions": [
+		{"effect": "deny", "when": "operator.id == \"mallory\"", "description": "offboarded"},
+		{"effect": "allow", "when": "\"auditor\" in operator.roles && action == Read"}
+	]}`
+	p, err := ParsePolicy([]byte(src))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+
+	auditor := User{ID: "audrey", Roles: []string{"auditor"}}
+	if err := NewStateTransform("creator", auditor, DatasetStateBanned, DatasetActionRead, WithPolicy(p)).Check(); err != nil {
+		t.Fatalf("auditor read: %v", err)
+	}
+	if err := NewStateTransform("creator", auditor, DatasetStateBanned, DatasetActionExec, WithPolicy(p)).Check(); err == nil {
+		t.Fatal("auditor exec: expected error, got nil")
+	}
+	mallory := User{ID: "mallory", Roles: []string{"admin"}}
+	err = NewStateTransform("creator", mallory, DatasetStateReleased, DatasetActionRead, WithPolicy(p)).Check()
+	if !errors.Is(err, ErrConditionDenied) {
+		t.Fatalf("mallory read: expected ErrConditionDenied, got %v", err)
+	}
+
+	for _, bad := range []string{
+		`{"effect": "maybe", "when": "true"}`,
+		`{"effect": "deny", "when": "state =="}`,
+	} {
+		src := strings.TrimSuffix(string(base), "}") + `,"conditions": [` + bad + `]}`
+		if _, err := ParsePolicy([]byte(src)); err == nil || !strings.Contains(err.Error(), "condition 0") {
+			t.Fatalf("condition %s: expected error, got %v", bad, err)
+		}
+	}
+}
+
+func BenchmarkConditionEval(b *testing.B) {
+	c := MustCompileCondition(`("auditor" in operator.roles && action == Read) || (operator.id == creatorID && state != Banned)`)
+	operator := User{ID: "creator", Roles: []string{"developer", "viewer"}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c.Eval("creator", operator, DatasetStateReleased, DatasetActionExec)
+	}
+}
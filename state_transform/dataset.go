@@ -0,0 +1,155 @@
+package state_transform
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrVersionNotFound is returned for operations on a version a Dataset does
+// not have.
+var ErrVersionNotFound = errors.New("dataset version not found")
+
+// DatasetVersion is one release line of a Dataset.
+type DatasetVersion struct {
+	Version int
+	State   DatasetState
+	// Tombstone is set while the version is deleted.
+	Tombstone *Tombstone
+}
+
+// Dataset is an aggregate of every version of one dataset. All changes go
+// through StateTransform and keep the cascading rules: at most one version
+// is Released at a time, and publishing a version outdates the previous
+// release. A Dataset is not safe for concurrent use.
+type Dataset struct {
+	ID        string
+	CreatorID string
+
+	versions []DatasetVersion
+	opts     []Option
+}
+
+// NewDataset returns a dataset with no versions. opts are passed to every
+// StateTransform the dataset creates.
+func NewDataset(id, creatorID string, opts ...Option) *Dataset {
+	return &Dataset{ID: id, CreatorID: creatorID, opts: opts}
+}
+
+// Versions returns every version in ascending order.
+func (d *Dataset) Versions() []DatasetVersion {
+	return append([]DatasetVersion(nil), d.versions...)
+}
+
+// Version returns the given version.
+func (d *Dataset) Version(version int) (DatasetVersion, error) {
+	i, err := d.index(version)
+	if err != nil {
+		return DatasetVersion{}, err
+	}
+	return d.versions[i], nil
+}
+
+// Released returns the version currently in DatasetStateReleased, if any.
+func (d *Dataset) Released() (DatasetVersion, bool) {
+	for _, v := range d.versions {
+		if v.State == DatasetStateReleased {
+			return v, true
+		}
+	}
+	return DatasetVersion{}, false
+}
+
+// NewVersion develops a new version on top of the existing ones and returns
+// its number.
+func (d *Dataset) NewVersion(operator User) (int, error) {
+	version := len(d.versions) + 1
+	st := d.transform(operator, version, DatasetStateInvalid, DatasetActionDevelop)
+	next, err := st.transition()
+	if err != nil {
+		return 0, err
+	}
+	d.versions = append(d.versions, DatasetVersion{Version: version, State: next})
+	st.hooks.notify(st.event())
+	return version, nil
+}
+
+// Apply performs action on one version. Publishing a version moves the
+// previously released version to DatasetStateOutdated; that cascade is
+// vetoed, journaled and announced like a transition of its own, made by the
+// same operator, and a veto of it cancels the publish.
+func (d *Dataset) Apply(operator User, version int, action DatasetAction) error {
+	i, err := d.index(version)
+	if err != nil {
+		return err
+	}
+	v := &d.versions[i]
+	var opts []Option
+	if v.Tombstone != nil {
+		opts = append(opts, WithTombstone(*v.Tombstone))
+	}
+	st := d.transform(operator, version, v.State, action, opts...)
+	err = st.authorize()
+	var outdate *StateTransform
+	if err == nil && st.nextState() == DatasetStateReleased && v.State != DatasetStateReleased {
+		if prev, ok := d.Released(); ok {
+			outdate = d.transform(operator, prev.Version, prev.State, DatasetActionOutdate)
+			err = outdate.hooks.veto(outdate.event())
+		}
+	}
+	next, err := st.commit(err)
+	if err != nil || next == v.State {
+		return err
+	}
+	if outdate != nil {
+		if _, err := outdate.commit(nil); err != nil {
+			return err
+		}
+		d.versions[outdate.version-1].State = DatasetStateOutdated
+		outdate.hooks.notify(outdate.event())
+	}
+	v.Tombstone = nil
+	if next == DatasetStateDeleted {
+		v.Tombstone = st.newTombstone()
+	}
+	v.State = next
+	st.hooks.notify(st.event())
+	return nil
+}
+
+// BanAll bans every version that is neither banned nor deleted yet. The
+// operator must be allowed to ban each of them and no veto hook may object;
+// otherwise nothing changes and only the refused ban is journaled.
+func (d *Dataset) BanAll(operator User) error {
+	var bans []*StateTransform
+	for _, v := range d.versions {
+		if v.State == DatasetStateBanned || v.State == DatasetStateDeleted {
+			continue
+		}
+		st := d.transform(operator, v.Version, v.State, DatasetActionBan)
+		if err := st.authorize(); err != nil {
+			_, err = st.commit(err)
+			return fmt.Errorf("version %d: %w", v.Version, err)
+		}
+		bans = append(bans, st)
+	}
+	for _, st := range bans {
+		if _, err := st.commit(nil); err != nil {
+			return fmt.Errorf("version %d: %w", st.version, err)
+		}
+		d.versions[st.version-1].State = DatasetStateBanned
+		st.hooks.notify(st.event())
+	}
+	return nil
+}
+
+func (d *Dataset) transform(operator User, version int, state DatasetState, action DatasetAction, opts ...Option) *StateTransform {
+	opts = append(append(append([]Option(nil), d.opts...), opts...), withDataset(d.ID, version))
+	return newStateTransform(d.CreatorID, operator, state, action, opts...)
+}
+
+func (d *Dataset) index(version int) (int, error) {
+	if version < 1 || version > len(d.versions) {
+		return 0, fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+	return version - 1, nil
+}
@@ -0,0 +1,85 @@
+package state_transform
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func versionStates(d *Dataset) []DatasetState {
+	var states []DatasetState
+	for _, v := range d.Versions() {
+		states = append(states, v.State)
+	}
+	return states
+}
+
+func TestDatasetPublishOutdatesPreviousRelease(t *testing.T) {
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	d := NewDataset("ds", creator.ID)
+
+	for i := 0; i < 3; i++ {
+		if _, err := d.NewVersion(creator); err != nil {
+			t.Fatalf("new version: %v", err)
+		}
+	}
+	if err := d.Apply(creator, 1, DatasetActionPublish); err != nil {
+		t.Fatalf("publish v1: %v", err)
+	}
+	if err := d.Apply(creator, 2, DatasetActionPublish); err != nil {
+		t.Fatalf("publish v2: %v", err)
+	}
+	want := []DatasetState{DatasetStateOutdated, DatasetStateReleased, DatasetStateDevelopment}
+	if got := versionStates(d); !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if v, ok := d.Released(); !ok || v.Version != 2 {
+		t.Fatalf("expected version 2 released, got %+v", v)
+	}
+
+	// Re-publishing the released version must not outdate it.
+	if err := d.Apply(creator, 2, DatasetActionPublish); err != nil {
+		t.Fatalf("republish v2: %v", err)
+	}
+	if got := versionStates(d); !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestDatasetBans(t *testing.T) {
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	normalUser := User{ID: "normalUser", Roles: []string{"developer"}}
+	d := NewDataset("ds", creator.ID)
+	for i := 0; i < 2; i++ {
+		if _, err := d.NewVersion(creator); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Apply(creator, 1, DatasetActionPublish); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Apply(admin, 1, DatasetActionBan); err != nil {
+		t.Fatalf("ban v1: %v", err)
+	}
+	if got, want := versionStates(d), []DatasetState{DatasetStateBanned, DatasetStateDevelopment}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	if err := d.BanAll(normalUser); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("ban all by normal user: expected permission denied, got %v", err)
+	}
+	if got := d.versions[1].State; got != DatasetStateDevelopment {
+		t.Fatalf("failed ban all changed version 2 to %s", got)
+	}
+	if err := d.BanAll(admin); err != nil {
+		t.Fatalf("ban all: %v", err)
+	}
+	if got, want := versionStates(d), []DatasetState{DatasetStateBanned, DatasetStateBanned}; !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if err := d.Apply(creator, 3, DatasetActionRead); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("expected ErrVersionNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package state_transform
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Risk ranks a policy change by how much it could hurt.
+type Risk int
+
+const (
+	// RiskLow is a permission that was revoked.
+	RiskLow Risk = iota
+	// RiskMedium is a new permission to read or execute, or any new
+	// permission of the creator.
+	RiskMedium
+	// RiskHigh is a new permission for someone other than the creator to
+	// change a dataset or its state, or to touch a banned dataset at all.
+	RiskHigh
+)
+
+var riskNames = [...]string{RiskLow: "low", RiskMedium: "medium", RiskHigh: "high"}
+
+func (r Risk) String() string {
+	if r < 0 || int(r) >= len(riskNames) {
+		return fmt.Sprintf("Risk(%d)", int(r))
+	}
+	return riskNames[r]
+}
+
+// PolicyChange is one decision that differs between two policies.
+type PolicyChange struct {
+	Profile Profile
+	State   DatasetState
+	Action  DatasetAction
+	// Allowed is the decision of the new policy; the old policy decided the
+	// opposite.
+	Allowed bool
+	Risk    Risk
+}
+
+// String describes the change, e.g. "non-creator developer gained modify on
+// released".
+func (c PolicyChange) String() string {
+	verb := "lost"
+	if c.Allowed {
+		verb = "gained"
+	}
+	return fmt.Sprintf("%s %s %s on %s", c.Profile, verb, c.Action, c.State)
+}
+
+// DiffPolicies compares every decision of from and to for the profiles
+// Enumerate would generate from the roles of both policies, and returns the
+// decisions that flipped, highest risk first. Within a risk the changes keep
+// the enumeration order: by profile, then state, then action.
+func DiffPolicies(from, to *Policy) []PolicyChange {
+	roles := make(map[string]bool)
+	for _, p := range []*Policy{from, to} {
+		for _, role := range p.roleNames() {
+			roles[role] = true
+		}
+	}
+
+	var changes []PolicyChange
+	for _, profile := range profiles(sortedKeys(roles)) {
+		for _, state := range AllDatasetStates() {
+			for _, action := range AllDatasetActions() {
+				before := from.decide(profile, state, action).Allowed
+				after := to.decide(profile, state, action).Allowed
+				if before == after {
+					continue
+				}
+				c := PolicyChange{Profile: profile, State: state, Action: action, Allowed: after}
+				c.Risk = c.risk()
+				changes = append(changes, c)
+			}
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Risk > changes[j].Risk })
+	return changes
+}
+
+func (c PolicyChange) risk() Risk {
+	switch {
+	case !c.Allowed:
+		return RiskLow
+	case c.Profile.IsOwner():
+		return RiskMedium
+	case c.State == DatasetStateBanned:
+		return RiskHigh
+	case c.Action == DatasetActionRead || c.Action == DatasetActionExec:
+		return RiskMedium
+	default:
+		return RiskHigh
+	}
+}
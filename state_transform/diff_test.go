@@ -0,0 +1,43 @@
+package state_transform
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	if changes := DiffPolicies(DefaultPolicy(), DefaultPolicy()); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", changes)
+	}
+
+	p := defaultPolicyWith(t,
+		move{"developer", "released", "modify", true},
+		move{"grant:reader", "invalid", "read", true},
+		move{"viewer", "released", "exec", false},
+	)
+	changes := DiffPolicies(DefaultPolicy(), p)
+	got := make(map[Risk][]string)
+	for i, c := range changes {
+		if i > 0 && changes[i-1].Risk < c.Risk {
+			t.Fatalf("changes not ordered by risk: %v", changes)
+		}
+		got[c.Risk] = append(got[c.Risk], c.String())
+	}
+	for risk, want := range map[Risk]string{
+		RiskHigh:   "non-creator developer gained modify on released",
+		RiskMedium: "reader grantee without roles gained read on invalid",
+		RiskLow:    "non-creator viewer lost exec on released",
+	} {
+		if !slices.Contains(got[risk], want) {
+			t.Fatalf("expected %q among %s risk changes %v", want, risk, got[risk])
+		}
+	}
+	// Maintainers could already modify released datasets.
+	if slices.Contains(got[RiskHigh], "non-creator maintainer gained modify on released") {
+		t.Fatal("unchanged decisions must not be reported")
+	}
+	// Executor grants still allow viewers to execute.
+	if slices.Contains(got[RiskLow], "executor grantee viewer lost exec on released") {
+		t.Fatal("unchanged decisions must not be reported")
+	}
+}
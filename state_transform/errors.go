@@ -0,0 +1,91 @@
+package state_transform
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DenialReason is a machine-readable code explaining why Check denied an
+// action.
+type DenialReason string
+
+const (
+	// ReasonNotCreator means only the dataset creator may perform the action.
+	ReasonNotCreator DenialReason = "not_creator"
+	// ReasonRoleForbidden means another role could perform the action, but
+	// none of the operator's roles can.
+	ReasonRoleForbidden DenialReason = "role_forbidden"
+	// ReasonStateForbidden means no operator may perform the action while the
+	// dataset is in its current state.
+	ReasonStateForbidden DenialReason = "state_forbidden"
+	// ReasonDatasetBanned means the action is blocked because the dataset is
+	// banned.
+	ReasonDatasetBanned DenialReason = "dataset_banned"
+	// ReasonEmbargoed means the dataset may not be published before its
+	// embargo ends.
+	ReasonEmbargoed DenialReason = "embargoed"
+	// ReasonApprovalRequired means publishing needs an approved request, see
+	// ApprovalWorkflow.
+	ReasonApprovalRequired DenialReason = "approval_required"
+	// ReasonConditionDenied means a deny condition of the policy matched.
+	ReasonConditionDenied DenialReason = "condition_denied"
+	// ReasonRetentionExpired means a deleted dataset can no longer be
+	// restored.
+	ReasonRetentionExpired DenialReason = "retention_expired"
+	// ReasonTombstoneRequired means a restore was checked without the
+	// dataset's tombstone, so the state to return to is unknown.
+	ReasonTombstoneRequired DenialReason = "tombstone_required"
+	// ReasonCrossTenant means the dataset belongs to another tenant and is
+	// not a public release.
+	ReasonCrossTenant DenialReason = "cross_tenant"
+)
+
+var (
+	// ErrPermissionDenied matches every *DenialError.
+	ErrPermissionDenied = errors.New("permission denied")
+
+	ErrNotCreator       = errors.New("operator is not the dataset creator")
+	ErrRoleForbidden    = errors.New("operator role does not permit the action")
+	ErrStateForbidden   = errors.New("dataset state does not permit the action")
+	ErrDatasetBanned    = errors.New("dataset is banned")
+	ErrEmbargoed        = errors.New("dataset is under embargo")
+	ErrNeedsApproval    = errors.New("publishing requires approval")
+	ErrConditionDenied  = errors.New("a policy condition denies the action")
+	ErrRetentionExpired = errors.New("dataset retention window has expired")
+	ErrNoTombstone      = errors.New("restoring requires the dataset's tombstone")
+	ErrCrossTenant      = errors.New("dataset belongs to another tenant")
+
+	ErrInvalidState  = errors.New("invalid dataset state")
+	ErrInvalidAction = errors.New("invalid dataset action")
+)
+
+var reasonErrors = map[DenialReason]error{
+	ReasonNotCreator:        ErrNotCreator,
+	ReasonRoleForbidden:     ErrRoleForbidden,
+	ReasonStateForbidden:    ErrStateForbidden,
+	ReasonDatasetBanned:     ErrDatasetBanned,
+	ReasonEmbargoed:         ErrEmbargoed,
+	ReasonApprovalRequired:  ErrNeedsApproval,
+	ReasonConditionDenied:   ErrConditionDenied,
+	ReasonRetentionExpired:  ErrRetentionExpired,
+	ReasonTombstoneRequired: ErrNoTombstone,
+	ReasonCrossTenant:       ErrCrossTenant,
+}
+
+// DenialError is returned by Check when the policy denies an action.
+// It matches ErrPermissionDenied and the sentinel for its Reason with
+// errors.Is.
+type DenialError struct {
+	State      DatasetState
+	Action     DatasetAction
+	OperatorID string
+	Reason     DenialReason
+}
+
+func (e *DenialError) Error() string {
+	return fmt.Sprintf("operator %q may not %s a %s dataset: %s", e.OperatorID, e.Action, e.State, e.Reason)
+}
+
+func (e *DenialError) Is(target error) bool {
+	return target == ErrPermissionDenied || target == reasonErrors[e.Reason]
+}
@@ -0,0 +1,51 @@
+package state_transform
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDenialErrors(t *testing.T) {
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	normalUser := User{ID: "normalUser", Roles: []string{"developer"}}
+	guest := User{ID: "guest"}
+
+	tests := []struct {
+		operator User
+		state    DatasetState
+		action   DatasetAction
+		reason   DenialReason
+		sentinel error
+	}{
+		{normalUser, DatasetStateDevelopment, DatasetActionModify, ReasonNotCreator, ErrNotCreator},
+		{creator, DatasetStateBanned, DatasetActionModify, ReasonDatasetBanned, ErrDatasetBanned},
+		{creator, DatasetStateOutdated, DatasetActionPublish, ReasonStateForbidden, ErrStateForbidden},
+		{creator, DatasetStateInvalid, DatasetActionRead, ReasonStateForbidden, ErrStateForbidden},
+		{guest, DatasetStateReleased, DatasetActionRead, ReasonRoleForbidden, ErrRoleForbidden},
+	}
+	for i, test := range tests {
+		err := NewStateTransform(creator.ID, test.operator, test.state, test.action).Check()
+		if !errors.Is(err, ErrPermissionDenied) || !errors.Is(err, test.sentinel) {
+			t.Fatalf("test %d: expected %v, got %v", i, test.sentinel, err)
+		}
+		var denial *DenialError
+		if !errors.As(err, &denial) {
+			t.Fatalf("test %d: expected *DenialError, got %T", i, err)
+		}
+		if denial.Reason != test.reason || denial.State != test.state || denial.Action != test.action || denial.OperatorID != test.operator.ID {
+			t.Fatalf("test %d: unexpected denial %+v", i, denial)
+		}
+	}
+}
+
+func TestInvalidRequestErrors(t *testing.T) {
+	creator := User{ID: "creator"}
+	err := NewStateTransform(creator.ID, creator, DatasetState(42), DatasetActionRead).Check()
+	if !errors.Is(err, ErrInvalidState) || errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("expected ErrInvalidState, got %v", err)
+	}
+	err = NewStateTransform(creator.ID, creator, DatasetStateReleased, DatasetAction(-1)).Check()
+	if !errors.Is(err, ErrInvalidAction) {
+		t.Fatalf("expected ErrInvalidAction, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package state_transform
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// StepResult is the outcome of one evaluated rule in a decision trace.
+type StepResult string
+
+const (
+	StepPassed  StepResult = "pass"
+	StepFailed  StepResult = "fail"
+	StepMatched StepResult = "match"
+	StepSkipped StepResult = "skip"
+	StepAllowed StepResult = "allow"
+	StepDenied  StepResult = "deny"
+)
+
+// TraceStep is one rule evaluated while deciding a StateTransform.
+type TraceStep struct {
+	Rule   string
+	Result StepResult
+	Detail string
+}
+
+// Decision is the result of a StateTransform together with the rules that
+// produced it. DecidedBy indexes the step that settled the result; when no
+// rule allowed the action that is the final "default" step.
+type Decision struct {
+	CreatorID  string
+	OperatorID string
+	State      DatasetState
+	Action     DatasetAction
+	Allowed    bool
+	NextState  DatasetState
+	Err        error
+	Steps      []TraceStep
+	DecidedBy  int
+}
+
+// trace collects decision steps. A nil *trace records nothing, which keeps
+// Check free of tracing cost.
+type trace struct {
+	steps     []TraceStep
+	decidedBy int
+}
+
+func (t *trace) add(rule string, result StepResult, format string, args ...any) {
+	if t == nil {
+		return
+	}
+	t.steps = append(t.steps, TraceStep{Rule: rule, Result: result, Detail: fmt.Sprintf(format, args...)})
+}
+
+// decide marks the most recently added step as the deciding one.
+func (t *trace) decide() {
+	if t == nil {
+		return
+	}
+	t.decidedBy = len(t.steps) - 1
+}
+
+// Explain evaluates the transform like Check and returns the full decision
+// trace. Explain does not record the decision in the journal.
+func (s *StateTransform) Explain() Decision {
+	t := &trace{decidedBy: -1}
+	err := s.evaluate(t)
+	d := Decision{
+		CreatorID:  s.creatorID,
+		OperatorID: s.operator.ID,
+		State:      s.state,
+		Action:     s.action,
+		Allowed:    err == nil,
+		NextState:  s.state,
+		Err:        err,
+		Steps:      t.steps,
+		DecidedBy:  t.decidedBy,
+	}
+	if err == nil {
+		d.NextState = s.nextState()
+	}
+	return d
+}
+
+// String renders the decision as a numbered, human-readable trace.
+func (d Decision) String() string {
+	var b strings.Builder
+	outcome := "allowed"
+	if !d.Allowed {
+		outcome = "denied"
+		var denial *DenialError
+		if errors.As(d.Err, &denial) {
+			outcome += " (" + string(denial.Reason) + ")"
+		}
+	}
+	fmt.Fprintf(&b, "operator %q %s on %s dataset of %q: %s\n", d.OperatorID, d.Action, d.State, d.CreatorID, outcome)
+	for i, step := range d.Steps {
+		marker := " "
+		if i == d.DecidedBy {
+			marker = "*"
+		}
+		fmt.Fprintf(&b, "%s %d. [%s] %s: %s\n", marker, i+1, step.Result, step.Rule, step.Detail)
+	}
+	if d.DecidedBy < 0 {
+		if d.Err != nil {
+			fmt.Fprintf(&b, "  => %v\n", d.Err)
+		}
+	} else {
+		fmt.Fprintf(&b, "  => decided by step %d\n", d.DecidedBy+1)
+	}
+	return b.String()
+}
@@ -0,0 +1,44 @@
+package state_transform
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	normalUser := User{ID: "normalUser", Roles: []string{"developer"}}
+
+	d := NewStateTransform(creator.ID, creator, DatasetStateDevelopment, DatasetActionPublish).Explain()
+	if !d.Allowed || d.NextState != DatasetStateReleased || d.Err != nil {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+	if step := d.Steps[d.DecidedBy]; step.Rule != "policy creator" || step.Result != StepAllowed {
+		t.Fatalf("expected creator policy to decide, got %+v", step)
+	}
+
+	d = NewStateTransform(creator.ID, normalUser, DatasetStateDevelopment, DatasetActionPublish).Explain()
+	if d.Allowed || !errors.Is(d.Err, ErrNotCreator) {
+		t.Fatalf("unexpected decision %+v", d)
+	}
+	var rules []string
+	for _, step := range d.Steps {
+		rules = append(rules, step.Rule+"="+string(step.Result))
+	}
+	want := "input=pass creator=skip grants=skip roles=pass policy developer=deny policy viewer=deny default=deny"
+	if got := strings.Join(rules, " "); got != want {
+		t.Fatalf("expected steps %q, got %q", want, got)
+	}
+	if d.DecidedBy != len(d.Steps)-1 {
+		t.Fatalf("expected the default rule to decide, got step %d", d.DecidedBy)
+	}
+	if out := d.String(); !strings.Contains(out, "denied (not_creator)") || !strings.Contains(out, "* 7. [deny] default") {
+		t.Fatalf("unexpected rendering:\n%s", out)
+	}
+
+	d = NewStateTransform(creator.ID, creator, DatasetState(9), DatasetActionRead).Explain()
+	if d.Allowed || len(d.Steps) != 1 || d.DecidedBy != 0 || d.Steps[0].Result != StepFailed {
+		t.Fatalf("unexpected decision for invalid state %+v", d)
+	}
+}
@@ -0,0 +1,63 @@
+package state_transform
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGrants(t *testing.T) {
+	grants := []Grant{
+		{UserID: "carol", Level: GrantCoOwner},
+		{UserID: "dave", Level: GrantMaintainer},
+		{Group: "ml-readers", Level: GrantReader},
+		{Group: "trainers", Level: GrantExecutor},
+	}
+	carol := User{ID: "carol", Roles: []string{"developer"}}
+	dave := User{ID: "dave", Roles: []string{"developer"}}
+	erin := User{ID: "erin", Groups: []string{"ml-readers"}}
+	frank := User{ID: "frank", Groups: []string{"trainers"}}
+
+	tests := []struct {
+		operator User
+		state    DatasetState
+		action   DatasetAction
+		allow    bool
+	}{
+		{carol, DatasetStateDevelopment, DatasetActionDelete, true},
+		{carol, DatasetStateBanned, DatasetActionRead, true},
+		{dave, DatasetStateDevelopment, DatasetActionPublish, true},
+		{dave, DatasetStateReleased, DatasetActionModify, true},
+		{dave, DatasetStateReleased, DatasetActionBan, false},
+		{erin, DatasetStateDevelopment, DatasetActionRead, true},
+		{erin, DatasetStateDevelopment, DatasetActionExec, true},
+		{erin, DatasetStateBanned, DatasetActionExec, false},
+		{erin, DatasetStateReleased, DatasetActionModify, false},
+		{frank, DatasetStateDevelopment, DatasetActionExec, true},
+		{frank, DatasetStateBanned, DatasetActionRead, false},
+	}
+	for i, test := range tests {
+		err := NewStateTransform("creator", test.operator, test.state, test.action, WithGrants(grants...)).Check()
+		if test.allow != (err == nil) {
+			t.Fatalf("test %d: %s %s on %s: expected allow=%v, got %v", i, test.operator.ID, test.action, test.state, test.allow, err)
+		}
+	}
+
+	err := NewStateTransform("creator", erin, DatasetStateReleased, DatasetActionModify, WithGrants(grants...)).Check()
+	if !errors.Is(err, ErrNotCreator) {
+		t.Fatalf("expected ErrNotCreator for reader modify, got %v", err)
+	}
+}
+
+func TestParsePolicyRejectsBadGrants(t *testing.T) {
+	for _, policy := range []string{
+		`{"subjects": {"grant:owner": ` + auditorRow + `}}`,
+		`{"subjects": {"grant:co-owner": ` + auditorRow + `}}`,
+		`{"subjects": {"auditor": ` + auditorRow + `}, "roles": {"grant:reader": {}}}`,
+	} {
+		_, err := ParsePolicy([]byte(policy))
+		if err == nil || !strings.Contains(err.Error(), "grant") {
+			t.Fatalf("policy %s: expected grant error, got %v", policy, err)
+		}
+	}
+}
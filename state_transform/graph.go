@@ -0,0 +1,149 @@
+package state_transform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LifecycleEdge groups the actions that move a dataset from one state to
+// another. From equals To for state-preserving actions.
+type LifecycleEdge struct {
+	From    DatasetState
+	To      DatasetState
+	Actions []DatasetAction
+}
+
+// LifecycleGraph is the dataset state machine restricted to what a set of
+// policy subjects may do.
+type LifecycleGraph struct {
+	Subjects []string
+	Edges    []LifecycleEdge
+	// Conditions lists the policy's allow and deny conditions, e.g.
+	// "deny when operator.tenant == \"sandbox\"". They are not reflected in
+	// Edges.
+	Conditions []string
+}
+
+// Graph builds the lifecycle graph for an operator matching subjects. Role
+// subjects are expanded through the role hierarchy, so Graph("developer")
+// also includes what viewers may do. Edges are ordered by source state,
+// then target state.
+//
+// Restore returns a dataset to the state it was deleted from, so its edges
+// lead from deleted back to every state any subject of the policy may
+// delete from.
+//
+// The graph is drawn from the subjects' allow and deny tables alone. Policy
+// conditions depend on the operator and dataset and are only listed in
+// Conditions; guards such as embargoes, approvals, tenants and tombstones
+// are not shown either. Check may therefore deny an edge shown here, or
+// allow one that is missing.
+func (p *Policy) Graph(subjects ...string) LifecycleGraph {
+	var roles []string
+	expanded := make([]string, 0, len(subjects))
+	for _, subject := range subjects {
+		if subject == SubjectCreator || isGrantSubject(subject) {
+			expanded = append(expanded, subject)
+		} else {
+			roles = append(roles, subject)
+		}
+	}
+	expanded = append(expanded, p.ResolveRoles(roles)...)
+
+	g := LifecycleGraph{Subjects: append([]string(nil), subjects...)}
+	for _, c := range p.conditions {
+		effect := "deny"
+		if c.allow {
+			effect = "allow"
+		}
+		g.Conditions = append(g.Conditions, fmt.Sprintf("%s when %s", effect, c.when))
+	}
+	restored := p.deletableStates()
+	for _, from := range AllDatasetStates() {
+		var byTarget [datasetStateCount][]DatasetAction
+		for _, action := range AllDatasetActions() {
+			for _, subject := range expanded {
+				if !p.Allowed(subject, from, action) {
+					continue
+				}
+				if action == DatasetActionRestore && from == DatasetStateDeleted {
+					for _, to := range restored {
+						byTarget[to] = append(byTarget[to], action)
+					}
+				} else {
+					to := NextState(from, action)
+					byTarget[to] = append(byTarget[to], action)
+				}
+				break
+			}
+		}
+		for to, actions := range byTarget {
+			if len(actions) > 0 {
+				g.Edges = append(g.Edges, LifecycleEdge{From: from, To: DatasetState(to), Actions: actions})
+			}
+		}
+	}
+	return g
+}
+
+// deletableStates returns the states other than deleted that some subject
+// of the policy may delete a dataset from.
+func (p *Policy) deletableStates() []DatasetState {
+	var states []DatasetState
+	for _, state := range AllDatasetStates() {
+		if state == DatasetStateDeleted {
+			continue
+		}
+		for _, subject := range p.Subjects() {
+			if p.Allowed(subject, state, DatasetActionDelete) {
+				states = append(states, state)
+				break
+			}
+		}
+	}
+	return states
+}
+
+func (e LifecycleEdge) label() string {
+	names := make([]string, len(e.Actions))
+	for i, action := range e.Actions {
+		names[i] = action.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+// DOT renders the graph in Graphviz format.
+func (g LifecycleGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph lifecycle {\n")
+	b.WriteString("\trankdir=LR;\n")
+	fmt.Fprintf(&b, "\tlabel=%q;\n", "subjects: "+strings.Join(g.Subjects, ", "))
+	for _, c := range g.Conditions {
+		fmt.Fprintf(&b, "\t// not reflected: %s\n", c)
+	}
+	for _, state := range AllDatasetStates() {
+		fmt.Fprintf(&b, "\t%s;\n", state)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s [label=%q];\n", e.From, e.To, e.label())
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the graph as a Mermaid state diagram.
+func (g LifecycleGraph) Mermaid() string {
+	var b strings.Builder
+	b.WriteString("stateDiagram-v2\n")
+	fmt.Fprintf(&b, "\t%%%% subjects: %s\n", strings.Join(g.Subjects, ", "))
+	for _, c := range g.Conditions {
+		fmt.Fprintf(&b, "\t%%%% not reflected: %s\n", c)
+	}
+	for _, state := range AllDatasetStates() {
+		fmt.Fprintf(&b, "\t%s\n", state)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s --> %s : %s\n", e.From, e.To, e.label())
+	}
+	return b.String()
+}
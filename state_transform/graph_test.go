@@ -0,0 +1,80 @@
+package state_transform
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	g := DefaultPolicy().Graph("developer")
+	want := map[[2]DatasetState]string{
+		{DatasetStateInvalid, DatasetStateDevelopment}:     "develop",
+		{DatasetStateDevelopment, DatasetStateDevelopment}: "develop",
+		{DatasetStateReleased, DatasetStateReleased}:       "publish, read, exec",
+		{DatasetStateOutdated, DatasetStateOutdated}:       "outdate, read",
+	}
+	if len(g.Edges) != len(want) {
+		t.Fatalf("expected %d edges, got %+v", len(want), g.Edges)
+	}
+	for _, e := range g.Edges {
+		if label, ok := want[[2]DatasetState{e.From, e.To}]; !ok || label != e.label() {
+			t.Fatalf("unexpected edge %s -> %s [%s]", e.From, e.To, e.label())
+		}
+	}
+
+	creator := DefaultPolicy().Graph(SubjectCreator)
+	dot := creator.DOT()
+	for _, line := range []string{
+		`development -> released [label="publish"];`,
+		`released -> outdated [label="outdate"];`,
+		`banned -> deleted [label="delete"];`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Fatalf("DOT output missing %q:\n%s", line, dot)
+		}
+	}
+	if mermaid := creator.Mermaid(); !strings.Contains(mermaid, "outdated --> banned : ban") {
+		t.Fatalf("Mermaid output missing ban edge:\n%s", mermaid)
+	}
+
+	// Restore goes back to whatever state the dataset was deleted from.
+	admin := DefaultPolicy().Graph("admin")
+	var restores []DatasetState
+	for _, e := range admin.Edges {
+		if e.From == DatasetStateDeleted {
+			if e.label() != "restore" {
+				t.Fatalf("unexpected edge %s -> %s [%s]", e.From, e.To, e.label())
+			}
+			restores = append(restores, e.To)
+		}
+	}
+	wantRestores := []DatasetState{DatasetStateDevelopment, DatasetStateReleased, DatasetStateOutdated, DatasetStateBanned}
+	if !slices.Equal(restores, wantRestores) {
+		t.Fatalf("expected restore edges to %v, got %v", wantRestores, restores)
+	}
+	if dot := admin.DOT(); !strings.Contains(dot, `deleted -> banned [label="restore"];`) {
+		t.Fatalf("DOT output missing restore edge:\n%s", dot)
+	}
+}
+
+func TestGraphListsConditions(t *testing.T) {
+	p, err := ParsePolicy([]byte(`{"subjects": {"auditor": ` + auditorRow + `}, "conditions": [{"effect": "deny", "when": "operator.tenant == \"sandbox\""}]}`))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	g := p.Graph("auditor")
+	want := `deny when operator.tenant == "sandbox"`
+	if len(g.Conditions) != 1 || g.Conditions[0] != want {
+		t.Fatalf("expected conditions [%s], got %q", want, g.Conditions)
+	}
+	if dot := g.DOT(); !strings.Contains(dot, "// not reflected: "+want) {
+		t.Fatalf("DOT output does not mention the condition:\n%s", dot)
+	}
+	if mermaid := g.Mermaid(); !strings.Contains(mermaid, "%% not reflected: "+want) {
+		t.Fatalf("Mermaid output does not mention the condition:\n%s", mermaid)
+	}
+	if len(DefaultPolicy().Graph(SubjectCreator).Conditions) != 0 {
+		t.Fatal("the default policy has no conditions")
+	}
+}
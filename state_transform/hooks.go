@@ -0,0 +1,319 @@
+package state_transform
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// TransitionEvent describes a state change. It is emitted only for actions
+// that change the state; reads, executions and other no-op actions produce
+// no event. DatasetID, Version and Revision are set when the transition
+// went through a Repository or Dataset.
+//
+// Expired is set when the change undoes Action because its effect ran out,
+// as when a temporary ban lifts; OperatorID is then the operator who
+// applied it.
+type TransitionEvent struct {
+	DatasetID  string
+	Version    int
+	Revision   uint64
+	CreatorID  string
+	OperatorID string
+	Action     DatasetAction
+	From       DatasetState
+	To         DatasetState
+	Time       time.Time
+	Expired    bool
+}
+
+// VetoHook runs synchronously before a transition takes effect. Returning an
+// error cancels the transition.
+type VetoHook func(TransitionEvent) error
+
+// NotifyHook is called asynchronously after a transition took effect. A
+// returned error makes Hooks retry the delivery.
+type NotifyHook func(TransitionEvent) error
+
+var (
+	// ErrVetoed matches every *VetoError.
+	ErrVetoed = errors.New("transition vetoed")
+	// ErrHooksClosed is recorded for events emitted after Hooks.Close.
+	ErrHooksClosed = errors.New("hooks are closed")
+	// ErrHookQueueFull is recorded for events a subscriber was too far
+	// behind to accept.
+	ErrHookQueueFull = errors.New("hook queue is full")
+)
+
+// VetoError is returned by Transition when a veto hook rejected the change.
+// It matches ErrVetoed with errors.Is and unwraps to the hook's error.
+type VetoError struct {
+	Hook  string
+	Event TransitionEvent
+	Err   error
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("%s %s -> %s vetoed by %s: %v", e.Event.Action, e.Event.From, e.Event.To, e.Hook, e.Err)
+}
+
+func (e *VetoError) Is(target error) bool {
+	return target == ErrVetoed
+}
+
+func (e *VetoError) Unwrap() error {
+	return e.Err
+}
+
+// RetryPolicy controls how often a failed notification is delivered again.
+// The wait before each retry doubles, starting at Backoff.
+type RetryPolicy struct {
+	Attempts int
+	Backoff  time.Duration
+}
+
+// DefaultRetryPolicy is used by NewHooks for zero fields of its argument.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 100 * time.Millisecond}
+
+// DeadLetter is a notification that failed on every attempt.
+type DeadLetter struct {
+	Hook     string
+	Event    TransitionEvent
+	Err      error
+	Attempts int
+}
+
+// hookQueueSize is how many events a subscriber may fall behind before
+// further events for it are dead-lettered.
+const hookQueueSize = 256
+
+// Hooks is a registry of transition hooks, attached to checkers with
+// WithHooks. Veto hooks run in registration order on the caller's goroutine;
+// the first error cancels the transition. Each notify hook has its own
+// goroutine and receives its events in the order the transitions happened.
+// Transitions never wait for a notify hook: events for a subscriber whose
+// queue is full are dead-lettered with ErrHookQueueFull and can be
+// redelivered later. Hooks is safe for concurrent use.
+type Hooks struct {
+	retry RetryPolicy
+
+	mu          sync.RWMutex
+	vetoes      []namedVeto
+	subscribers []*subscriber
+	closed      bool
+	wg          sync.WaitGroup
+
+	deadMu sync.Mutex
+	dead   []DeadLetter
+}
+
+type namedVeto struct {
+	name string
+	fn   VetoHook
+}
+
+type subscriber struct {
+	name    string
+	fn      NotifyHook
+	actions []DatasetAction
+	queue   chan TransitionEvent
+}
+
+// NewHooks returns an empty registry that retries failed notifications as
+// retry says.
+func NewHooks(retry RetryPolicy) *Hooks {
+	if retry.Attempts <= 0 {
+		retry.Attempts = DefaultRetryPolicy.Attempts
+	}
+	if retry.Backoff <= 0 {
+		retry.Backoff = DefaultRetryPolicy.Backoff
+	}
+	return &Hooks{retry: retry}
+}
+
+// WithHooks runs the veto hooks of h before, and the notify hooks after,
+// every transition that changes the state.
+func WithHooks(h *Hooks) Option {
+	return func(s *StateTransform) {
+		s.hooks = h
+	}
+}
+
+// Veto registers a veto hook.
+func (h *Hooks) Veto(name string, fn VetoHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.vetoes = append(h.vetoes, namedVeto{name: name, fn: fn})
+}
+
+// Subscribe registers a notify hook for transitions caused by actions, or
+// by any action when none are given.
+func (h *Hooks) Subscribe(name string, fn NotifyHook, actions ...DatasetAction) {
+	sub := &subscriber{name: name, fn: fn, actions: actions, queue: make(chan TransitionEvent, hookQueueSize)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.subscribers = append(h.subscribers, sub)
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		for e := range sub.queue {
+			h.deliver(sub, e)
+		}
+	}()
+}
+
+// DeadLetters returns the notifications that failed on every attempt, oldest
+// first.
+func (h *Hooks) DeadLetters() []DeadLetter {
+	h.deadMu.Lock()
+	defer h.deadMu.Unlock()
+	return append([]DeadLetter(nil), h.dead...)
+}
+
+// Redeliver queues every dead letter for its hook again and returns how many
+// were queued. Letters whose hook is no longer subscribed, or whose queue is
+// full, stay dead.
+func (h *Hooks) Redeliver() int {
+	h.deadMu.Lock()
+	dead := h.dead
+	h.dead = nil
+	h.deadMu.Unlock()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	queued := 0
+	for _, letter := range dead {
+		i := slices.IndexFunc(h.subscribers, func(sub *subscriber) bool { return sub.name == letter.Hook })
+		if i < 0 || h.closed || !h.subscribers[i].enqueue(letter.Event) {
+			h.bury(letter)
+			continue
+		}
+		queued++
+	}
+	return queued
+}
+
+// Close stops accepting events and waits until every queued notification
+// was delivered or dead-lettered.
+func (h *Hooks) Close() {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		for _, sub := range h.subscribers {
+			close(sub.queue)
+		}
+	}
+	h.mu.Unlock()
+	h.wg.Wait()
+}
+
+// veto asks every veto hook about e. A nil *Hooks allows everything.
+func (h *Hooks) veto(e TransitionEvent) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.RLock()
+	vetoes := h.vetoes
+	h.mu.RUnlock()
+	for _, v := range vetoes {
+		if err := v.fn(e); err != nil {
+			return &VetoError{Hook: v.name, Event: e, Err: err}
+		}
+	}
+	return nil
+}
+
+// notify queues e for every matching subscriber. A nil *Hooks does nothing.
+func (h *Hooks) notify(e TransitionEvent) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, sub := range h.subscribers {
+		if len(sub.actions) > 0 && !slices.Contains(sub.actions, e.Action) {
+			continue
+		}
+		if h.closed {
+			h.bury(DeadLetter{Hook: sub.name, Event: e, Err: ErrHooksClosed})
+			continue
+		}
+		if !sub.enqueue(e) {
+			h.bury(DeadLetter{Hook: sub.name, Event: e, Err: ErrHookQueueFull})
+		}
+	}
+}
+
+// enqueue hands e to the subscriber's goroutine unless its queue is full.
+func (sub *subscriber) enqueue(e TransitionEvent) bool {
+	select {
+	case sub.queue <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+// deliver calls the subscriber until it succeeds or runs out of attempts.
+func (h *Hooks) deliver(sub *subscriber, e TransitionEvent) {
+	backoff := h.retry.Backoff
+	for attempt := 1; ; attempt++ {
+		err := call(sub.fn, e)
+		if err == nil {
+			return
+		}
+		if attempt >= h.retry.Attempts {
+			h.bury(DeadLetter{Hook: sub.name, Event: e, Err: err, Attempts: attempt})
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// bury adds a letter to the dead-letter list.
+func (h *Hooks) bury(letter DeadLetter) {
+	h.deadMu.Lock()
+	defer h.deadMu.Unlock()
+	h.dead = append(h.dead, letter)
+}
+
+// call runs a notify hook, turning a panic into an error so one broken
+// subscriber cannot take the process down.
+func call(fn NotifyHook, e TransitionEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("notify hook panicked: %v", r)
+		}
+	}()
+	return fn(e)
+}
+
+// event describes the transition s is about to make.
+func (s *StateTransform) event() TransitionEvent {
+	return TransitionEvent{
+		DatasetID:  s.datasetID,
+		Version:    s.version,
+		CreatorID:  s.creatorID,
+		OperatorID: s.operator.ID,
+		Action:     s.action,
+		From:       s.state,
+		To:         s.nextState(),
+		Time:       s.clock.Now(),
+	}
+}
+
+// withDataset tells the checker which dataset, and which version of it, it
+// decides for, so events can name it.
+func withDataset(id string, version int) Option {
+	return func(s *StateTransform) {
+		s.datasetID = id
+		s.version = version
+	}
+}
@@ -0,0 +1,278 @@
+package state_transform
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a notify hook that remembers what it received.
+type recorder struct {
+	mu     sync.Mutex
+	events []TransitionEvent
+}
+
+func (r *recorder) hook(e TransitionEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recorder) received() []TransitionEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]TransitionEvent(nil), r.events...)
+}
+
+func TestHooksNotify(t *testing.T) {
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	hooks := NewHooks(RetryPolicy{})
+	var all, bans recorder
+	hooks.Subscribe("all", all.hook)
+	hooks.Subscribe("bans", bans.hook, DatasetActionBan)
+
+	repo := NewMemoryRepository(WithHooks(hooks))
+	rec, _ := repo.Create("ds", "creator")
+	for _, action := range []DatasetAction{DatasetActionDevelop, DatasetActionRead, DatasetActionPublish, DatasetActionBan} {
+		var err error
+		if rec, err = repo.Apply("ds", rec.Revision, admin, action); err != nil {
+			t.Fatalf("%s: %v", action, err)
+		}
+	}
+	// Denied and conflicting changes are not announced.
+	repo.Apply("ds", rec.Revision, User{ID: "guest"}, DatasetActionDelete)
+	repo.Apply("ds", 1, admin, DatasetActionDelete)
+	hooks.Close()
+
+	got := all.received()
+	if len(got) != 3 {
+		t.Fatalf("expected develop, publish and ban events, got %+v", got)
+	}
+	want := TransitionEvent{DatasetID: "ds", Revision: 4, CreatorID: "creator", OperatorID: "admin", Action: DatasetActionBan, From: DatasetStateReleased, To: DatasetStateBanned}
+	if e := got[2]; e.Time.IsZero() {
+		t.Fatalf("event without time: %+v", e)
+	} else if want.Time = e.Time; e != want {
+		t.Fatalf("expected %+v, got %+v", want, e)
+	}
+	if got := bans.received(); len(got) != 1 || got[0].Action != DatasetActionBan {
+		t.Fatalf("expected only the ban, got %+v", got)
+	}
+
+	// Events after Close are dead-lettered.
+	NewStateTransform("creator", admin, DatasetStateReleased, DatasetActionOutdate, WithHooks(hooks)).Transition()
+	if dead := hooks.DeadLetters(); len(dead) != 1 || !errors.Is(dead[0].Err, ErrHooksClosed) || dead[0].Hook != "all" {
+		t.Fatalf("unexpected dead letters %+v", dead)
+	}
+}
+
+func TestHooksVeto(t *testing.T) {
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	var buf bytes.Buffer
+	hooks := NewHooks(RetryPolicy{})
+	notReady := errors.New("index not ready")
+	hooks.Veto("search-index", func(e TransitionEvent) error {
+		if e.Action == DatasetActionPublish {
+			return notReady
+		}
+		return nil
+	})
+	var notified recorder
+	hooks.Subscribe("notified", notified.hook)
+
+	d := NewDataset("ds", creator.ID, WithHooks(hooks), WithJournal(NewJournal(&buf)))
+	v, err := d.NewVersion(creator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.Apply(creator, v, DatasetActionPublish)
+	var veto *VetoError
+	if !errors.Is(err, ErrVetoed) || !errors.Is(err, notReady) || !errors.As(err, &veto) || veto.Hook != "search-index" {
+		t.Fatalf("expected veto by search-index, got %v", err)
+	}
+	if got, _ := d.Version(v); got.State != DatasetStateDevelopment {
+		t.Fatalf("vetoed publish changed the state to %s", got.State)
+	}
+	hooks.Close()
+
+	got := notified.received()
+	if len(got) != 1 || got[0].Action != DatasetActionDevelop || got[0].DatasetID != "ds" || got[0].Version != v {
+		t.Fatalf("expected only the develop event, got %+v", got)
+	}
+	entries, err := ReadJournal(&buf)
+	if err != nil || len(entries) != 2 || entries[1].Outcome != OutcomeDenied {
+		t.Fatalf("expected the veto to be journaled as denied: %+v, %v", entries, err)
+	}
+}
+
+func TestHooksRetryAndDeadLetters(t *testing.T) {
+	hooks := NewHooks(RetryPolicy{Attempts: 3, Backoff: time.Millisecond})
+	var mu sync.Mutex
+	calls := map[DatasetAction]int{}
+	healthy := false
+	hooks.Subscribe("flaky", func(e TransitionEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[e.Action]++
+		switch {
+		case e.Action == DatasetActionBan:
+			panic("boom")
+		case healthy || calls[e.Action] == 3:
+			return nil
+		}
+		return errors.New("unavailable")
+	})
+
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	for _, action := range []DatasetAction{DatasetActionPublish, DatasetActionBan} {
+		if _, err := NewStateTransform("creator", admin, DatasetStateDevelopment, action, WithHooks(hooks)).Transition(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(hooks.DeadLetters()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	dead := hooks.DeadLetters()
+	if len(dead) != 1 || dead[0].Event.Action != DatasetActionBan || dead[0].Attempts != 3 || dead[0].Err == nil {
+		t.Fatalf("unexpected dead letters %+v", dead)
+	}
+
+	mu.Lock()
+	if calls[DatasetActionPublish] != 3 {
+		t.Fatalf("expected publish to succeed on the third attempt, got %d calls", calls[DatasetActionPublish])
+	}
+	healthy = true
+	mu.Unlock()
+	if n := hooks.Redeliver(); n != 1 {
+		t.Fatalf("expected one redelivery, got %d", n)
+	}
+	hooks.Close()
+	if dead := hooks.DeadLetters(); len(dead) != 1 || calls[DatasetActionBan] != 6 {
+		t.Fatalf("expected the panicking hook to fail again: %+v, %d calls", dead, calls[DatasetActionBan])
+	}
+}
+
+func TestHooksSeeOutdateCascade(t *testing.T) {
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	journal := NewJournal(nil)
+	hooks := NewHooks(RetryPolicy{})
+	var notified recorder
+	hooks.Subscribe("outdates", notified.hook, DatasetActionOutdate)
+	frozen := false
+	hooks.Veto("freeze", func(e TransitionEvent) error {
+		if frozen && e.Action == DatasetActionOutdate {
+			return errors.New("release frozen")
+		}
+		return nil
+	})
+
+	d := NewDataset("ds", creator.ID, WithHooks(hooks), WithJournal(journal))
+	v1, _ := d.NewVersion(creator)
+	if err := d.Apply(creator, v1, DatasetActionPublish); err != nil {
+		t.Fatal(err)
+	}
+	v2, _ := d.NewVersion(creator)
+	frozen = true
+	if err := d.Apply(creator, v2, DatasetActionPublish); !errors.Is(err, ErrVetoed) {
+		t.Fatalf("expected the vetoed cascade to cancel the publish, got %v", err)
+	}
+	if got, _ := d.Version(v1); got.State != DatasetStateReleased {
+		t.Fatalf("vetoed cascade outdated version 1: %s", got.State)
+	}
+	frozen = false
+	if err := d.Apply(creator, v2, DatasetActionPublish); err != nil {
+		t.Fatal(err)
+	}
+	hooks.Close()
+
+	got := notified.received()
+	want := TransitionEvent{DatasetID: "ds", Version: v1, CreatorID: "creator", OperatorID: "creator", Action: DatasetActionOutdate, From: DatasetStateReleased, To: DatasetStateOutdated}
+	if len(got) != 1 {
+		t.Fatalf("expected one outdate event, got %+v", got)
+	}
+	if want.Time = got[0].Time; got[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, got[0])
+	}
+	entries := journal.Entries()
+	last := entries[len(entries)-2:]
+	if last[0].Action != DatasetActionPublish || last[0].Outcome != OutcomeAllowed ||
+		last[1].Action != DatasetActionOutdate || last[1].Outcome != OutcomeAllowed || last[1].To != DatasetStateOutdated {
+		t.Fatalf("expected publish and outdate to be journaled, got %+v", last)
+	}
+}
+
+func TestBanAllJournalsNothingWhenRefused(t *testing.T) {
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	journal := NewJournal(nil)
+	hooks := NewHooks(RetryPolicy{})
+	defer hooks.Close()
+	hooks.Veto("legal-hold", func(e TransitionEvent) error {
+		if e.Action == DatasetActionBan && e.Version == 2 {
+			return errors.New("under legal hold")
+		}
+		return nil
+	})
+
+	d := NewDataset("ds", "creator", WithHooks(hooks), WithJournal(journal))
+	d.NewVersion(admin)
+	d.NewVersion(admin)
+	before := len(journal.Entries())
+	if err := d.BanAll(admin); !errors.Is(err, ErrVetoed) {
+		t.Fatalf("expected ErrVetoed, got %v", err)
+	}
+	for _, v := range d.Versions() {
+		if v.State == DatasetStateBanned {
+			t.Fatalf("version %d was banned", v.Version)
+		}
+	}
+	entries := journal.Entries()[before:]
+	if len(entries) != 1 || entries[0].Outcome != OutcomeDenied {
+		t.Fatalf("expected only the refused ban to be journaled, got %+v", entries)
+	}
+}
+
+func TestHooksNeverBlockTransitions(t *testing.T) {
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	hooks := NewHooks(RetryPolicy{})
+	release := make(chan struct{})
+	hooks.Subscribe("stuck", func(TransitionEvent) error {
+		<-release
+		return nil
+	})
+	repo := NewMemoryRepository(WithHooks(hooks))
+	rec, _ := repo.Create("ds", "creator")
+
+	// One event is being delivered, hookQueueSize wait in the queue and the
+	// rest have nowhere to go.
+	const transitions = hookQueueSize + 3
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		for i := 0; i < transitions && err == nil; i++ {
+			action := DatasetActionDevelop
+			if i%2 == 1 {
+				action = DatasetActionPublish
+			}
+			rec, err = repo.Apply("ds", rec.Revision, admin, action)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("transitions blocked on a stuck subscriber")
+	}
+
+	dead := hooks.DeadLetters()
+	if len(dead) < 2 || !errors.Is(dead[0].Err, ErrHookQueueFull) {
+		t.Fatalf("expected overflowing events to be dead-lettered, got %d: %+v", len(dead), dead)
+	}
+	close(release)
+	hooks.Close()
+}
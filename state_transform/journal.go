@@ -0,0 +1,217 @@
+package state_transform
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Outcome is the result of a recorded decision.
+type Outcome string
+
+const (
+	OutcomeAllowed Outcome = "allowed"
+	OutcomeDenied  Outcome = "denied"
+	// OutcomeExpired records that the effect of an earlier action ran out,
+	// such as a temporary ban lifting. To is the state the dataset returned
+	// to.
+	OutcomeExpired Outcome = "expired"
+)
+
+// JournalEntry is one decision in the audit journal. Hash covers every other
+// field, including PrevHash, so changing any entry breaks the chain from
+// that point on.
+type JournalEntry struct {
+	Seq        uint64        `json:"seq"`
+	Time       time.Time     `json:"time"`
+	OperatorID string        `json:"operator_id"`
+	CreatorID  string        `json:"creator_id"`
+	From       DatasetState  `json:"from"`
+	Action     DatasetAction `json:"action"`
+	To         DatasetState  `json:"to"`
+	Outcome    Outcome       `json:"outcome"`
+	Reason     string        `json:"reason,omitempty"`
+	PrevHash   string        `json:"prev_hash"`
+	Hash       string        `json:"hash"`
+}
+
+func (e JournalEntry) computeHash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Journal is an append-only, hash-chained log of StateTransform decisions.
+// When created with a writer every entry is also written to it as one JSON
+// line, so the log can be reloaded with ReadJournal and verified later.
+type Journal struct {
+	mu      sync.Mutex
+	w       io.Writer
+	entries []JournalEntry
+}
+
+// NewJournal returns an empty journal. w may be nil to keep entries in
+// memory only.
+func NewJournal(w io.Writer) *Journal {
+	return &Journal{w: w}
+}
+
+// Append chains entry onto the journal, filling in Seq, Time (if zero),
+// PrevHash and Hash, and returns the stored entry.
+func (j *Journal) Append(entry JournalEntry) (JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry.Seq = uint64(len(j.entries))
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC().Round(0)
+	entry.PrevHash = ""
+	if n := len(j.entries); n > 0 {
+		entry.PrevHash = j.entries[n-1].Hash
+	}
+	entry.Hash = entry.computeHash()
+
+	if j.w != nil {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return JournalEntry{}, fmt.Errorf("encode journal entry: %w", err)
+		}
+		if _, err := j.w.Write(append(data, '\n')); err != nil {
+			return JournalEntry{}, fmt.Errorf("write journal entry: %w", err)
+		}
+	}
+	j.entries = append(j.entries, entry)
+	return entry, nil
+}
+
+// Entries returns a copy of every entry recorded so far.
+func (j *Journal) Entries() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]JournalEntry(nil), j.entries...)
+}
+
+// Verify checks the journal's own chain. See VerifyJournal.
+func (j *Journal) Verify() error {
+	return VerifyJournal(j.Entries())
+}
+
+// ChainError reports the first journal entry whose hash chain is broken.
+type ChainError struct {
+	Index  int
+	Seq    uint64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("journal entry %d (seq %d): %s", e.Index, e.Seq, e.Reason)
+}
+
+// VerifyJournal walks entries in order and returns a *ChainError for the
+// first one that was modified, removed or reordered, or nil if the chain is
+// intact.
+func VerifyJournal(entries []JournalEntry) error {
+	prev := ""
+	for i, entry := range entries {
+		switch {
+		case entry.Seq != uint64(i):
+			return &ChainError{Index: i, Seq: entry.Seq, Reason: fmt.Sprintf("expected seq %d", i)}
+		case entry.PrevHash != prev:
+			return &ChainError{Index: i, Seq: entry.Seq, Reason: "previous hash mismatch"}
+		case entry.computeHash() != entry.Hash:
+			return &ChainError{Index: i, Seq: entry.Seq, Reason: "hash mismatch"}
+		}
+		prev = entry.Hash
+	}
+	return nil
+}
+
+// ReadJournal decodes entries written by a Journal, one JSON object per line.
+func ReadJournal(r io.Reader) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("journal line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read journal: %w", err)
+	}
+	return entries, nil
+}
+
+// WithJournal records every Check and Transition decision in j. If the
+// journal cannot be written the decision fails, so nothing is allowed
+// without a trace.
+func WithJournal(j *Journal) Option {
+	return func(s *StateTransform) {
+		s.journal = j
+	}
+}
+
+// record appends the outcome of a decision to the configured journal.
+func (s *StateTransform) record(err error) error {
+	if s.journal == nil {
+		return nil
+	}
+	entry := JournalEntry{
+		Time:       s.clock.Now(),
+		OperatorID: s.operator.ID,
+		CreatorID:  s.creatorID,
+		From:       s.state,
+		Action:     s.action,
+		To:         s.state,
+		Outcome:    OutcomeDenied,
+	}
+	var denial *DenialError
+	switch {
+	case err == nil:
+		entry.To = s.nextState()
+		entry.Outcome = OutcomeAllowed
+	case errors.As(err, &denial):
+		entry.Reason = string(denial.Reason)
+	default:
+		entry.Reason = err.Error()
+	}
+	if _, jerr := s.journal.Append(entry); jerr != nil {
+		return fmt.Errorf("record decision: %w", jerr)
+	}
+	return nil
+}
+
+// recordExpiry journals that the effect of the checker's action ran out and
+// the dataset returned to state to.
+func (s *StateTransform) recordExpiry(to DatasetState) error {
+	if s.journal == nil {
+		return nil
+	}
+	entry := JournalEntry{
+		Time:       s.clock.Now(),
+		OperatorID: s.operator.ID,
+		CreatorID:  s.creatorID,
+		From:       s.state,
+		Action:     s.action,
+		To:         to,
+		Outcome:    OutcomeExpired,
+	}
+	if _, err := s.journal.Append(entry); err != nil {
+		return fmt.Errorf("record expiry: %w", err)
+	}
+	return nil
+}
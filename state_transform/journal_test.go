@@ -0,0 +1,89 @@
+package state_transform
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJournalRecordsDecisions(t *testing.T) {
+	var buf bytes.Buffer
+	journal := NewJournal(&buf)
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	clock := WithClock(fixedClock(at))
+
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	normalUser := User{ID: "normalUser", Roles: []string{"developer"}}
+	if _, err := NewStateTransform(creator.ID, creator, DatasetStateDevelopment, DatasetActionPublish, WithJournal(journal), clock).Transition(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if err := NewStateTransform(creator.ID, normalUser, DatasetStateReleased, DatasetActionBan, WithJournal(journal), clock).Check(); err == nil {
+		t.Fatal("ban by normal user: expected error, got nil")
+	}
+
+	entries := journal.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if e := entries[0]; e.Outcome != OutcomeAllowed || e.From != DatasetStateDevelopment || e.To != DatasetStateReleased || e.OperatorID != "creator" || !e.Time.Equal(at) {
+		t.Fatalf("unexpected first entry %+v", e)
+	}
+	if e := entries[1]; e.Outcome != OutcomeDenied || e.To != DatasetStateReleased || e.Reason != string(ReasonNotCreator) || e.PrevHash != entries[0].Hash || !e.Time.Equal(at) {
+		t.Fatalf("unexpected second entry %+v", e)
+	}
+	if err := journal.Verify(); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+
+	reloaded, err := ReadJournal(&buf)
+	if err != nil {
+		t.Fatalf("read journal: %v", err)
+	}
+	if err := VerifyJournal(reloaded); err != nil {
+		t.Fatalf("verify reloaded journal: %v", err)
+	}
+}
+
+func TestVerifyJournalDetectsTampering(t *testing.T) {
+	journal := NewJournal(nil)
+	for i := 0; i < 4; i++ {
+		if _, err := journal.Append(JournalEntry{OperatorID: "admin", Action: DatasetActionBan, Outcome: OutcomeAllowed}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		tamper func([]JournalEntry) []JournalEntry
+		index  int
+	}{
+		{"edited", func(e []JournalEntry) []JournalEntry { e[2].OperatorID = "someone"; return e }, 2},
+		{"rehashed", func(e []JournalEntry) []JournalEntry {
+			e[1].Outcome = OutcomeDenied
+			e[1].Hash = e[1].computeHash()
+			return e
+		}, 2},
+		{"removed", func(e []JournalEntry) []JournalEntry { return append(e[:1], e[2:]...) }, 1},
+		{"swapped", func(e []JournalEntry) []JournalEntry { e[0], e[3] = e[3], e[0]; return e }, 0},
+	}
+	for _, test := range tests {
+		err := VerifyJournal(test.tamper(journal.Entries()))
+		var chainErr *ChainError
+		if !errors.As(err, &chainErr) || chainErr.Index != test.index {
+			t.Fatalf("%s: expected chain error at %d, got %v", test.name, test.index, err)
+		}
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestJournalFailureDeniesDecision(t *testing.T) {
+	creator := User{ID: "creator"}
+	err := NewStateTransform(creator.ID, creator, DatasetStateDevelopment, DatasetActionRead, WithJournal(NewJournal(failingWriter{}))).Check()
+	if err == nil {
+		t.Fatal("expected journal error, got nil")
+	}
+}
@@ -0,0 +1,255 @@
+package state_transform
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// SubjectCreator is the policy subject matched when the operator created the
+// dataset. Subjects starting with "grant:" are matched against the dataset's
+// collaborator grants, and every other subject name against the operator's
+// roles.
+const SubjectCreator = "creator"
+
+//go:embed default_policy.json
+var defaultPolicyJSON []byte
+
+var defaultPolicy = mustParsePolicy(defaultPolicyJSON)
+
+type permissionMatrix [datasetStateCount][datasetActionCount]bool
+
+// Policy is an allow/deny table keyed by subject, dataset state and action.
+// A Policy is immutable once loaded and safe for concurrent use.
+type Policy struct {
+	subjects   map[string]*permissionMatrix
+	inherits   map[string][]string
+	closure    map[string][]string
+	conditions []policyCondition
+}
+
+// policyCondition is a compiled conditional rule. Deny conditions are
+// checked before the matrix and allow conditions after it, so a matching
+// deny always wins.
+type policyCondition struct {
+	allow       bool
+	when        *Condition
+	description string
+}
+
+type policyFile struct {
+	Subjects   map[string]map[string]policyCell `json:"subjects"`
+	Roles      map[string]policyRole            `json:"roles,omitempty"`
+	Conditions []policyConditionFile            `json:"conditions,omitempty"`
+}
+
+type policyConditionFile struct {
+	Effect      string `json:"effect"`
+	When        string `json:"when"`
+	Description string `json:"description,omitempty"`
+}
+
+type policyRole struct {
+	Inherits []string `json:"inherits,omitempty"`
+}
+
+type policyCell struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// DefaultPolicy returns the built-in lifecycle policy.
+func DefaultPolicy() *Policy {
+	return defaultPolicy
+}
+
+// LoadPolicy reads and validates a JSON policy file.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy decodes and validates a JSON policy. Every subject must list
+// every state, and every state must place each action in exactly one of its
+// allow or deny lists. Roles may inherit other roles as long as the
+// inheritance graph has no cycles. Conditions must compile and have an
+// effect of "allow" or "deny".
+func ParsePolicy(data []byte) (*Policy, error) {
+	var file policyFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("decode policy: %w", err)
+	}
+	if len(file.Subjects) == 0 {
+		return nil, errors.New("invalid policy: no subjects defined")
+	}
+
+	p := &Policy{subjects: make(map[string]*permissionMatrix, len(file.Subjects))}
+	var errs []error
+	for _, subject := range sortedKeys(file.Subjects) {
+		if subject == "" {
+			errs = append(errs, errors.New("empty subject name"))
+			continue
+		}
+		if isGrantSubject(subject) {
+			if err := validateGrantSubject(subject); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		m, subjectErrs := parseMatrix(subject, file.Subjects[subject])
+		errs = append(errs, subjectErrs...)
+		p.subjects[subject] = m
+	}
+	errs = append(errs, p.buildRoles(file.Roles)...)
+	for i, c := range file.Conditions {
+		if c.Effect != "allow" && c.Effect != "deny" {
+			errs = append(errs, fmt.Errorf("condition %d: effect must be allow or deny, not %q", i, c.Effect))
+			continue
+		}
+		when, err := CompileCondition(c.When)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("condition %d: %w", i, err))
+			continue
+		}
+		p.conditions = append(p.conditions, policyCondition{allow: c.Effect == "allow", when: when, description: c.Description})
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid policy: %w", errors.Join(errs...))
+	}
+	return p, nil
+}
+
+func parseMatrix(subject string, states map[string]policyCell) (*permissionMatrix, []error) {
+	var (
+		m    permissionMatrix
+		errs []error
+	)
+	for name := range states {
+		if _, err := ParseDatasetState(name); err != nil {
+			errs = append(errs, fmt.Errorf("subject %q: %w", subject, err))
+		}
+	}
+	for _, state := range AllDatasetStates() {
+		cell, ok := states[state.String()]
+		if !ok {
+			errs = append(errs, fmt.Errorf("subject %q: state %s is not defined", subject, state))
+			continue
+		}
+
+		allowed := make(map[DatasetAction]bool, datasetActionCount)
+		for _, list := range []struct {
+			allow bool
+			names []string
+		}{{true, cell.Allow}, {false, cell.Deny}} {
+			for _, name := range list.names {
+				action, err := ParseDatasetAction(name)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("subject %q, state %s: %w", subject, state, err))
+					continue
+				}
+				if prev, dup := allowed[action]; dup {
+					if prev != list.allow {
+						errs = append(errs, fmt.Errorf("subject %q, state %s: action %s is both allowed and denied", subject, state, action))
+					} else {
+						errs = append(errs, fmt.Errorf("subject %q, state %s: action %s is listed twice", subject, state, action))
+					}
+					continue
+				}
+				allowed[action] = list.allow
+			}
+		}
+
+		for _, action := range AllDatasetActions() {
+			allow, ok := allowed[action]
+			if !ok {
+				errs = append(errs, fmt.Errorf("subject %q, state %s: action %s is neither allowed nor denied", subject, state, action))
+				continue
+			}
+			m[state][action] = allow
+		}
+	}
+	return &m, errs
+}
+
+func mustParsePolicy(data []byte) *Policy {
+	p, err := ParsePolicy(data)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Allowed reports whether the matrix lets subject apply action to a dataset
+// in state. Unknown subjects, states and actions are denied. Conditions are
+// not consulted; they need a full decision context and are evaluated by
+// Check.
+func (p *Policy) Allowed(subject string, state DatasetState, action DatasetAction) bool {
+	m, ok := p.subjects[subject]
+	if !ok || !state.Valid() || !action.Valid() {
+		return false
+	}
+	return m[state][action]
+}
+
+// HasSubject reports whether the policy defines a row for subject.
+func (p *Policy) HasSubject(subject string) bool {
+	_, ok := p.subjects[subject]
+	return ok
+}
+
+// Subjects returns the subjects defined by the policy in sorted order.
+func (p *Policy) Subjects() []string {
+	return sortedKeys(p.subjects)
+}
+
+// MarshalJSON encodes the policy in the same format ParsePolicy accepts.
+func (p *Policy) MarshalJSON() ([]byte, error) {
+	file := policyFile{Subjects: make(map[string]map[string]policyCell, len(p.subjects))}
+	for subject, m := range p.subjects {
+		states := make(map[string]policyCell, datasetStateCount)
+		for _, state := range AllDatasetStates() {
+			cell := policyCell{Allow: []string{}, Deny: []string{}}
+			for _, action := range AllDatasetActions() {
+				if m[state][action] {
+					cell.Allow = append(cell.Allow, action.String())
+				} else {
+					cell.Deny = append(cell.Deny, action.String())
+				}
+			}
+			states[state.String()] = cell
+		}
+		file.Subjects[subject] = states
+	}
+	if len(p.inherits) > 0 {
+		file.Roles = make(map[string]policyRole, len(p.inherits))
+		for role, parents := range p.inherits {
+			file.Roles[role] = policyRole{Inherits: parents}
+		}
+	}
+	for _, c := range p.conditions {
+		effect := "deny"
+		if c.allow {
+			effect = "allow"
+		}
+		file.Conditions = append(file.Conditions, policyConditionFile{Effect: effect, When: c.when.String(), Description: c.description})
+	}
+	return json.Marshal(file)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,84 @@
+package state_transform
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePolicyRejectsInvalid(t *testing.T) {
+	full := `"invalid": {"allow": ["develop"], "deny": ["publish", "outdate", "ban", "delete", "modify", "read", "exec", "restore"]},
+		"development": {"allow": ["develop"], "deny": ["publish", "outdate", "ban", "delete", "modify", "read", "exec", "restore"]},
+		"released": {"allow": ["develop"], "deny": ["publish", "outdate", "ban", "delete", "modify", "read", "exec", "restore"]},
+		"outdated": {"allow": ["develop"], "deny": ["publish", "outdate", "ban", "delete", "modify", "read", "exec", "restore"]},
+		"deleted": {"allow": ["restore"], "deny": ["develop", "publish", "outdate", "ban", "delete", "modify", "read", "exec"]}`
+
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{"empty", `{}`, "no subjects"},
+		{"unknown field", `{"subjects": {}, "extra": 1}`, "unknown field"},
+		{"missing state", `{"subjects": {"x": {` + full + `}}}`, "state banned is not defined"},
+		{"unknown state", `{"subjects": {"x": {` + full + `, "banned": {"deny": ["develop", "publish", "outdate", "ban", "delete", "modify", "read", "exec", "restore"]}, "archived": {}}}}`, `unknown dataset state "archived"`},
+		{"missing action", `{"subjects": {"x": {` + full + `, "banned": {"deny": ["develop", "publish", "outdate", "ban", "delete", "modify", "read"]}}}}`, "action exec is neither allowed nor denied"},
+		{"contradiction", `{"subjects": {"x": {` + full + `, "banned": {"allow": ["read"], "deny": ["develop", "publish", "outdate", "ban", "delete", "modify", "read", "exec", "restore"]}}}}`, "action read is both allowed and denied"},
+		{"duplicate", `{"subjects": {"x": {` + full + `, "banned": {"deny": ["develop", "develop", "publish", "outdate", "ban", "delete", "modify", "read", "exec", "restore"]}}}}`, "action develop is listed twice"},
+		{"unknown action", `{"subjects": {"x": {` + full + `, "banned": {"deny": ["fly", "develop", "publish", "outdate", "ban", "delete", "modify", "read", "exec", "restore"]}}}}`, `unknown dataset action "fly"`},
+	}
+	for _, test := range tests {
+		_, err := ParsePolicy([]byte(test.policy))
+		if err == nil {
+			t.Fatalf("%s: expected error, got nil", test.name)
+		}
+		if !strings.Contains(err.Error(), test.wantErr) {
+			t.Fatalf("%s: expected error containing %q, got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestLoadPolicyRoundTrip(t *testing.T) {
+	data, err := json.Marshal(DefaultPolicy())
+	if err != nil {
+		t.Fatalf("marshal default policy: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPolicy(path)
+	if err != nil {
+		t.Fatalf("load policy: %v", err)
+	}
+	for _, subject := range DefaultPolicy().Subjects() {
+		for _, state := range AllDatasetStates() {
+			for _, action := range AllDatasetActions() {
+				if p.Allowed(subject, state, action) != DefaultPolicy().Allowed(subject, state, action) {
+					t.Fatalf("subject %s, state %s, action %s differs after round trip", subject, state, action)
+				}
+			}
+		}
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	p, err := ParsePolicy([]byte(`{"subjects": {"auditor": ` + auditorRow + `}}`))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+
+	auditor := User{ID: "auditor", Roles: []string{"auditor"}}
+	if err := NewStateTransform("creator", auditor, DatasetStateBanned, DatasetActionRead, WithPolicy(p)).Check(); err != nil {
+		t.Fatalf("auditor read on banned: unexpected error %v", err)
+	}
+	if err := NewStateTransform("creator", auditor, DatasetStateBanned, DatasetActionRead).Check(); err == nil {
+		t.Fatal("auditor read on banned under default policy: expected error, got nil")
+	}
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	if err := NewStateTransform("creator", creator, DatasetStateDevelopment, DatasetActionPublish, WithPolicy(p)).Check(); err == nil {
+		t.Fatal("creator publish without creator subject: expected error, got nil")
+	}
+}
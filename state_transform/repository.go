@@ -0,0 +1,413 @@
+package state_transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDatasetNotFound = errors.New("dataset not found")
+	ErrDatasetExists   = errors.New("dataset already exists")
+	// ErrConflict is returned when an update is based on a stale revision.
+	ErrConflict = errors.New("dataset revision conflict")
+)
+
+// DatasetRecord is the stored lifecycle state of one dataset. Revision is
+// the optimistic-lock version: it starts at 1 and grows by one every time
+// the state changes.
+type DatasetRecord struct {
+	ID        string       `json:"id"`
+	CreatorID string       `json:"creator_id"`
+	State     DatasetState `json:"state"`
+	Revision  uint64       `json:"revision"`
+	// Tombstone is set while the dataset is in DatasetStateDeleted.
+	Tombstone *Tombstone `json:"tombstone,omitempty"`
+	// Embargo, when set, denies publishing the dataset before that instant.
+	Embargo *time.Time `json:"embargo,omitempty"`
+	// Ban is set while the dataset is under a temporary ban.
+	Ban *TemporaryBan `json:"ban,omitempty"`
+}
+
+// Repository stores dataset state and applies actions with compare-and-swap
+// semantics. Apply fails with ErrConflict unless expectedRevision is the
+// stored revision, so two operators acting on the same snapshot cannot both
+// win. opts given to Apply are added to the repository's own options for
+// that one call, e.g. to pass the dataset's grants.
+//
+// ForceState sets a state without consulting the policy, for repairs that
+// have no corresponding action. It is still subject to the revision check,
+// and clears any temporary ban. Forcing a dataset into DatasetStateDeleted
+// leaves a tombstone as deleting it would; forcing it out clears the
+// tombstone.
+//
+// Hooks given with WithHooks see Apply's state changes with the dataset ID
+// and, once stored, the new revision. Events are handed over after the
+// store lock is released, so concurrent changes may arrive out of order;
+// Revision orders the events of one dataset. ForceState emits no events.
+//
+// A ban applied by Scheduler.BanUntil leaves a TemporaryBan on the record;
+// any later state change clears it. LiftExpiredBans returns every dataset
+// whose ban has expired at now to the state it was banned from, journals
+// and announces each lift, and returns the lifted records.
+//
+// Deleting a dataset leaves a Tombstone on its record; restoring it clears
+// the tombstone. PurgeExpired removes every record whose tombstone has
+// expired at now and returns them.
+//
+// SetEmbargo stores an embargo on the record that every later Apply
+// enforces, whatever options it is called with; a zero until lifts it.
+type Repository interface {
+	Create(id, creatorID string) (DatasetRecord, error)
+	Get(id string) (DatasetRecord, error)
+	Apply(id string, expectedRevision uint64, operator User, action DatasetAction, opts ...Option) (DatasetRecord, error)
+	ForceState(id string, expectedRevision uint64, state DatasetState) (DatasetRecord, error)
+	PurgeExpired(now time.Time) ([]DatasetRecord, error)
+	LiftExpiredBans(now time.Time) ([]DatasetRecord, error)
+	SetEmbargo(id string, expectedRevision uint64, until time.Time) (DatasetRecord, error)
+}
+
+type store struct {
+	mu      sync.Mutex
+	records map[string]DatasetRecord
+	opts    []Option
+	// persist, when set, is called with the updated records before a change
+	// becomes visible. A persist error rolls the change back.
+	persist func(map[string]DatasetRecord) error
+}
+
+func (s *store) Create(id, creatorID string) (DatasetRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.records[id]; ok {
+		return DatasetRecord{}, fmt.Errorf("%w: %s", ErrDatasetExists, id)
+	}
+	rec := DatasetRecord{ID: id, CreatorID: creatorID, State: DatasetStateInvalid, Revision: 1}
+	if err := s.commit(rec); err != nil {
+		return DatasetRecord{}, err
+	}
+	return rec, nil
+}
+
+func (s *store) Get(id string) (DatasetRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[id]
+	if !ok {
+		return DatasetRecord{}, fmt.Errorf("%w: %s", ErrDatasetNotFound, id)
+	}
+	return rec, nil
+}
+
+func (s *store) Apply(id string, expectedRevision uint64, operator User, action DatasetAction, opts ...Option) (DatasetRecord, error) {
+	rec, notify, err := s.apply(id, expectedRevision, operator, action, opts...)
+	// Hooks are told after the lock is released, so they cannot hold up
+	// other changes.
+	if notify != nil {
+		notify()
+	}
+	return rec, err
+}
+
+// apply is Apply under the store lock. notify is set when the state changed
+// and announces the change.
+//
+// The decision is journaled once its outcome is known: a change is stored
+// first, so a failed write is journaled as a failure rather than as an
+// allowed transition, and rolled back if it cannot be journaled.
+func (s *store) apply(id string, expectedRevision uint64, operator User, action DatasetAction, opts ...Option) (rec DatasetRecord, notify func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err = s.lookup(id, expectedRevision)
+	if err != nil {
+		return rec, nil, err
+	}
+	opts = append(append([]Option(nil), s.opts...), opts...)
+	if rec.Tombstone != nil {
+		opts = append(opts, WithTombstone(*rec.Tombstone))
+	}
+	if rec.Embargo != nil {
+		opts = append(opts, withStoredEmbargo(*rec.Embargo))
+	}
+	opts = append(opts, withDataset(id, 0))
+	st := newStateTransform(rec.CreatorID, operator, rec.State, action, opts...)
+	err = st.authorize()
+	next := st.nextState()
+	if err != nil || next == rec.State {
+		_, err = st.commit(err)
+		return rec, nil, err
+	}
+	updated := rec
+	updated.State = next
+	updated.Tombstone = nil
+	if next == DatasetStateDeleted {
+		updated.Tombstone = st.newTombstone()
+	}
+	updated.Ban = nil
+	if next == DatasetStateBanned && !st.banUntil.IsZero() {
+		updated.Ban = &TemporaryBan{Until: st.banUntil, Restore: rec.State, OperatorID: operator.ID}
+	}
+	updated, err = s.update(rec, updated)
+	if err != nil {
+		_, err = st.commit(err)
+		return rec, nil, err
+	}
+	if _, err := st.commit(nil); err != nil {
+		if rerr := s.commit(rec); rerr != nil {
+			return updated, nil, errors.Join(err, fmt.Errorf("roll back: %w", rerr))
+		}
+		return rec, nil, err
+	}
+	e := st.event()
+	e.Revision = updated.Revision
+	return updated, func() { st.hooks.notify(e) }, nil
+}
+
+func (s *store) ForceState(id string, expectedRevision uint64, state DatasetState) (DatasetRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !state.Valid() {
+		return DatasetRecord{}, fmt.Errorf("%w: %d", ErrInvalidState, int(state))
+	}
+	rec, err := s.lookup(id, expectedRevision)
+	if err != nil || state == rec.State {
+		return rec, err
+	}
+	updated := rec
+	updated.State = state
+	updated.Ban = nil
+	updated.Tombstone = nil
+	if state == DatasetStateDeleted {
+		updated.Tombstone = newStateTransform(rec.CreatorID, User{}, rec.State, DatasetActionDelete, s.opts...).newTombstone()
+	}
+	return s.update(rec, updated)
+}
+
+func (s *store) SetEmbargo(id string, expectedRevision uint64, until time.Time) (DatasetRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.lookup(id, expectedRevision)
+	if err != nil {
+		return rec, err
+	}
+	updated := rec
+	updated.Embargo = nil
+	if !until.IsZero() {
+		updated.Embargo = &until
+	}
+	return s.update(rec, updated)
+}
+
+func (s *store) PurgeExpired(now time.Time) ([]DatasetRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged []DatasetRecord
+	for _, rec := range s.records {
+		if rec.State == DatasetStateDeleted && rec.Tombstone != nil && rec.Tombstone.Expired(now) {
+			purged = append(purged, rec)
+		}
+	}
+	if len(purged) == 0 {
+		return nil, nil
+	}
+	sort.Slice(purged, func(i, j int) bool { return purged[i].ID < purged[j].ID })
+	err := s.save(func(records map[string]DatasetRecord) {
+		for _, rec := range purged {
+			delete(records, rec.ID)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+func (s *store) LiftExpiredBans(now time.Time) ([]DatasetRecord, error) {
+	lifted, notify, err := s.liftExpiredBans(now)
+	notify()
+	return lifted, err
+}
+
+// liftExpiredBans is LiftExpiredBans under the store lock. notify announces
+// the stored lifts.
+func (s *store) liftExpiredBans(now time.Time) (lifted []DatasetRecord, notify func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []DatasetRecord
+	for _, rec := range s.records {
+		if rec.State == DatasetStateBanned && rec.Ban != nil && rec.Ban.Expired(now) {
+			due = append(due, rec)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+
+	var events []func()
+	var errs []error
+	for _, rec := range due {
+		opts := append(append([]Option(nil), s.opts...), withDataset(rec.ID, 0), WithClock(fixedClock(now)))
+		st := newStateTransform(rec.CreatorID, User{ID: rec.Ban.OperatorID}, rec.State, DatasetActionBan, opts...)
+		updated := rec
+		updated.State = rec.Ban.Restore
+		updated.Ban = nil
+		updated, err := s.update(rec, updated)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("lift ban of %s: %w", rec.ID, err))
+			continue
+		}
+		lifted = append(lifted, updated)
+		if err := st.recordExpiry(updated.State); err != nil {
+			errs = append(errs, fmt.Errorf("lift ban of %s: %w", rec.ID, err))
+		}
+		e := st.event()
+		e.To = updated.State
+		e.Revision = updated.Revision
+		e.Expired = true
+		events = append(events, func() { st.hooks.notify(e) })
+	}
+	notify = func() {
+		for _, event := range events {
+			event()
+		}
+	}
+	return lifted, notify, errors.Join(errs...)
+}
+
+// lookup returns the record for id if it is still at expectedRevision.
+func (s *store) lookup(id string, expectedRevision uint64) (DatasetRecord, error) {
+	rec, ok := s.records[id]
+	if !ok {
+		return DatasetRecord{}, fmt.Errorf("%w: %s", ErrDatasetNotFound, id)
+	}
+	if rec.Revision != expectedRevision {
+		return rec, fmt.Errorf("%w: %s is at revision %d, not %d", ErrConflict, id, rec.Revision, expectedRevision)
+	}
+	return rec, nil
+}
+
+// update replaces rec with updated and bumps the revision.
+func (s *store) update(rec, updated DatasetRecord) (DatasetRecord, error) {
+	updated.Revision = rec.Revision + 1
+	if err := s.commit(updated); err != nil {
+		return rec, err
+	}
+	return updated, nil
+}
+
+// commit stores rec.
+func (s *store) commit(rec DatasetRecord) error {
+	return s.save(func(records map[string]DatasetRecord) {
+		records[rec.ID] = rec
+	})
+}
+
+// save applies change to the records, persisting the result first when the
+// store is file-backed so a failed write leaves the records untouched.
+func (s *store) save(change func(map[string]DatasetRecord)) error {
+	if s.persist == nil {
+		change(s.records)
+		return nil
+	}
+	updated := make(map[string]DatasetRecord, len(s.records)+1)
+	for id, r := range s.records {
+		updated[id] = r
+	}
+	change(updated)
+	if err := s.persist(updated); err != nil {
+		return err
+	}
+	s.records = updated
+	return nil
+}
+
+// MemoryRepository is a Repository kept in process memory.
+type MemoryRepository struct {
+	store
+}
+
+// NewMemoryRepository returns an empty repository. opts are passed to every
+// StateTransform it runs.
+func NewMemoryRepository(opts ...Option) *MemoryRepository {
+	return &MemoryRepository{store: store{records: make(map[string]DatasetRecord), opts: opts}}
+}
+
+// FileRepository is a Repository persisted to a JSON file. Every change is
+// written to a temporary file and renamed over the old one, so the file is
+// never left half-written. The file must not be shared between processes.
+type FileRepository struct {
+	store
+	path string
+}
+
+type repositoryFile struct {
+	Datasets []DatasetRecord `json:"datasets"`
+}
+
+// OpenFileRepository loads the repository at path, starting empty if the
+// file does not exist yet.
+func OpenFileRepository(path string, opts ...Option) (*FileRepository, error) {
+	r := &FileRepository{
+		store: store{records: make(map[string]DatasetRecord), opts: opts},
+		path:  path,
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("read repository: %w", err)
+	default:
+		var file repositoryFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("decode repository: %w", err)
+		}
+		for _, rec := range file.Datasets {
+			r.records[rec.ID] = rec
+		}
+	}
+	r.persist = r.write
+	return r, nil
+}
+
+func (r *FileRepository) write(records map[string]DatasetRecord) error {
+	file := repositoryFile{Datasets: make([]DatasetRecord, 0, len(records))}
+	for _, rec := range records {
+		file.Datasets = append(file.Datasets, rec)
+	}
+	sort.Slice(file.Datasets, func(i, j int) bool { return file.Datasets[i].ID < file.Datasets[j].ID })
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode repository: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write repository: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write repository: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write repository: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write repository: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), r.path); err != nil {
+		return fmt.Errorf("write repository: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package state_transform
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRepositoryOptimisticLocking(t *testing.T) {
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+
+	file, err := OpenFileRepository(filepath.Join(t.TempDir(), "datasets.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, repo := range map[string]Repository{"memory": NewMemoryRepository(), "file": file} {
+		rec, err := repo.Create("ds", creator.ID)
+		if err != nil {
+			t.Fatalf("%s: create: %v", name, err)
+		}
+		if _, err := repo.Create("ds", creator.ID); !errors.Is(err, ErrDatasetExists) {
+			t.Fatalf("%s: expected ErrDatasetExists, got %v", name, err)
+		}
+		rec, err = repo.Apply("ds", rec.Revision, creator, DatasetActionDevelop)
+		if err != nil || rec.State != DatasetStateDevelopment || rec.Revision != 2 {
+			t.Fatalf("%s: develop: %+v, %v", name, rec, err)
+		}
+
+		// Both admins read revision 2; only the first write wins.
+		if _, err := repo.Apply("ds", 2, admin, DatasetActionPublish); err != nil {
+			t.Fatalf("%s: publish: %v", name, err)
+		}
+		if _, err := repo.Apply("ds", 2, admin, DatasetActionBan); !errors.Is(err, ErrConflict) {
+			t.Fatalf("%s: expected ErrConflict, got %v", name, err)
+		}
+
+		rec, err = repo.Apply("ds", 3, creator, DatasetActionRead)
+		if err != nil || rec.Revision != 3 {
+			t.Fatalf("%s: read must not bump the revision: %+v, %v", name, rec, err)
+		}
+		normalUser := User{ID: "normalUser", Roles: []string{"developer"}}
+		if _, err := repo.Apply("ds", 3, normalUser, DatasetActionBan); !errors.Is(err, ErrPermissionDenied) {
+			t.Fatalf("%s: expected ErrPermissionDenied, got %v", name, err)
+		}
+		if _, err := repo.Get("missing"); !errors.Is(err, ErrDatasetNotFound) {
+			t.Fatalf("%s: expected ErrDatasetNotFound, got %v", name, err)
+		}
+	}
+
+	reopened, err := OpenFileRepository(file.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec, err := reopened.Get("ds"); err != nil || rec.State != DatasetStateReleased || rec.Revision != 3 {
+		t.Fatalf("reopened: %+v, %v", rec, err)
+	}
+}
+
+func TestRepositoryConcurrentTransitions(t *testing.T) {
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	file, err := OpenFileRepository(filepath.Join(t.TempDir(), "datasets.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, repo := range map[string]Repository{"memory": NewMemoryRepository(), "file": file} {
+		if _, err := repo.Create("ds", "creator"); err != nil {
+			t.Fatal(err)
+		}
+
+		const workers, rounds = 16, 25
+		actions := []DatasetAction{DatasetActionDevelop, DatasetActionPublish, DatasetActionOutdate}
+		var applied atomic.Uint64
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < rounds; i++ {
+					rec, err := repo.Get("ds")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					next, err := repo.Apply("ds", rec.Revision, admin, actions[(w+i)%len(actions)])
+					if err == nil && next.Revision != rec.Revision {
+						applied.Add(1)
+					}
+					if err != nil && !errors.Is(err, ErrConflict) && !errors.Is(err, ErrPermissionDenied) {
+						t.Error(err)
+						return
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		rec, err := repo.Get("ds")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Revision != applied.Load()+1 {
+			t.Fatalf("%s: revision %d after %d applied transitions", name, rec.Revision, applied.Load())
+		}
+	}
+}
+
+func TestRepositoryJournalsAfterPersisting(t *testing.T) {
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	journal := NewJournal(nil)
+	repo := NewMemoryRepository(WithJournal(journal))
+	rec, _ := repo.Create("ds", "creator")
+	repo.persist = func(map[string]DatasetRecord) error { return errors.New("disk full") }
+
+	if _, err := repo.Apply("ds", rec.Revision, admin, DatasetActionDevelop); err == nil {
+		t.Fatal("expected the failed write to fail the transition")
+	}
+	entries := journal.Entries()
+	if len(entries) != 1 || entries[0].Outcome != OutcomeDenied || entries[0].Reason != "disk full" {
+		t.Fatalf("expected the failed write to be journaled, got %+v", entries)
+	}
+	if got, _ := repo.Get("ds"); got != rec {
+		t.Fatalf("expected %+v to stay unchanged, got %+v", rec, got)
+	}
+
+	// A change that cannot be journaled is rolled back.
+	repo = NewMemoryRepository(WithJournal(NewJournal(failingWriter{})))
+	rec, _ = repo.Create("ds", "creator")
+	if _, err := repo.Apply("ds", rec.Revision, admin, DatasetActionDevelop); err == nil {
+		t.Fatal("expected the journal failure to fail the transition")
+	}
+	if got, _ := repo.Get("ds"); got != rec {
+		t.Fatalf("expected %+v to be rolled back, got %+v", rec, got)
+	}
+}
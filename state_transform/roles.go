@@ -0,0 +1,106 @@
+package state_transform
+
+import (
+	"fmt"
+	"sort"
+)
+
+// buildRoles validates the role inheritance graph and precomputes, for every
+// role, the set of roles it implies.
+func (p *Policy) buildRoles(roles map[string]policyRole) []error {
+	var errs []error
+	p.inherits = make(map[string][]string, len(roles))
+	for _, role := range sortedKeys(roles) {
+		if role == "" || role == SubjectCreator || isGrantSubject(role) {
+			errs = append(errs, fmt.Errorf("invalid role name %q", role))
+			continue
+		}
+		p.inherits[role] = nil
+		seen := make(map[string]bool)
+		for _, parent := range roles[role].Inherits {
+			_, isRole := roles[parent]
+			if parent == SubjectCreator || isGrantSubject(parent) || (!isRole && !p.HasSubject(parent)) {
+				errs = append(errs, fmt.Errorf("role %q inherits unknown role %q", role, parent))
+				continue
+			}
+			if seen[parent] {
+				errs = append(errs, fmt.Errorf("role %q inherits %q twice", role, parent))
+				continue
+			}
+			seen[parent] = true
+			p.inherits[role] = append(p.inherits[role], parent)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	p.closure = make(map[string][]string)
+	for _, role := range p.roleNames() {
+		implied, err := p.implied(role, map[string]bool{})
+		if err != nil {
+			return append(errs, err)
+		}
+		p.closure[role] = sortedKeys(implied)
+	}
+	return nil
+}
+
+func (p *Policy) implied(role string, visiting map[string]bool) (map[string]bool, error) {
+	if visiting[role] {
+		return nil, fmt.Errorf("role %q inherits itself", role)
+	}
+	visiting[role] = true
+	defer delete(visiting, role)
+
+	implied := map[string]bool{role: true}
+	for _, parent := range p.inherits[role] {
+		sub, err := p.implied(parent, visiting)
+		if err != nil {
+			return nil, err
+		}
+		for r := range sub {
+			implied[r] = true
+		}
+	}
+	return implied, nil
+}
+
+// roleNames lists every role the policy knows: subjects other than the
+// creator and grants, plus roles that only exist in the inheritance graph.
+func (p *Policy) roleNames() []string {
+	names := make(map[string]bool)
+	for subject := range p.subjects {
+		if subject != SubjectCreator && !isGrantSubject(subject) {
+			names[subject] = true
+		}
+	}
+	for role := range p.inherits {
+		names[role] = true
+	}
+	return sortedKeys(names)
+}
+
+// Implies returns role together with every role it inherits, directly or
+// transitively, in sorted order. Unknown roles imply nothing.
+func (p *Policy) Implies(role string) []string {
+	return append([]string(nil), p.closure[role]...)
+}
+
+// ResolveRoles expands the roles a user holds into every role they
+// effectively have. The result is deterministic regardless of the input
+// order: roles implying more roles come first, ties are broken by name.
+// Roles the policy does not know are dropped.
+func (p *Policy) ResolveRoles(roles []string) []string {
+	effective := make(map[string]bool)
+	for _, role := range roles {
+		for _, r := range p.closure[role] {
+			effective[r] = true
+		}
+	}
+	resolved := sortedKeys(effective)
+	sort.SliceStable(resolved, func(i, j int) bool {
+		return len(p.closure[resolved[i]]) > len(p.closure[resolved[j]])
+	})
+	return resolved
+}
@@ -0,0 +1,90 @@
+package state_transform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const auditorRow = `{
+	"invalid": {"deny": ["develop", "publish", "outdate", "ban", "delete", "modify", "read", "exec", "restore"]},
+	"development": {"allow": ["read"], "deny": ["develop", "publish", "outdate", "ban", "delete", "modify", "exec", "restore"]},
+	"released": {"allow": ["read"], "deny": ["develop", "publish", "outdate", "ban", "delete", "modify", "exec", "restore"]},
+	"outdated": {"allow": ["read"], "deny": ["develop", "publish", "outdate", "ban", "delete", "modify", "exec", "restore"]},
+	"banned": {"allow": ["read"], "deny": ["develop", "publish", "outdate", "ban", "delete", "modify", "exec", "restore"]},
+	"deleted": {"deny": ["develop", "publish", "outdate", "ban", "delete", "modify", "read", "exec", "restore"]}
+}`
+
+func TestRoleHierarchy(t *testing.T) {
+	tests := []struct {
+		roles  []string
+		state  DatasetState
+		action DatasetAction
+		allow  bool
+	}{
+		{[]string{"viewer"}, DatasetStateReleased, DatasetActionRead, true},
+		{[]string{"viewer"}, DatasetStateInvalid, DatasetActionDevelop, false},
+		{[]string{"developer"}, DatasetStateReleased, DatasetActionExec, true},
+		{[]string{"maintainer"}, DatasetStateInvalid, DatasetActionDevelop, true},
+		{[]string{"maintainer"}, DatasetStateReleased, DatasetActionModify, true},
+		{[]string{"maintainer"}, DatasetStateReleased, DatasetActionBan, false},
+		{[]string{"viewer", "admin"}, DatasetStateReleased, DatasetActionBan, true},
+		{[]string{"unknown"}, DatasetStateReleased, DatasetActionRead, false},
+	}
+	for i, test := range tests {
+		operator := User{ID: "someone", Roles: test.roles}
+		err := NewStateTransform("creator", operator, test.state, test.action).Check()
+		if test.allow != (err == nil) {
+			t.Fatalf("test %d: roles %v, state %s, action %s: expected allow=%v, got %v", i, test.roles, test.state, test.action, test.allow, err)
+		}
+	}
+}
+
+func TestResolveRolesIsDeterministic(t *testing.T) {
+	p := DefaultPolicy()
+	want := []string{"admin", "maintainer", "developer", "viewer"}
+	for _, roles := range [][]string{{"admin"}, {"viewer", "admin"}, {"developer", "admin", "ghost"}} {
+		if got := p.ResolveRoles(roles); !reflect.DeepEqual(got, want) {
+			t.Fatalf("ResolveRoles(%v) = %v, want %v", roles, got, want)
+		}
+	}
+	if got := p.Implies("developer"); !reflect.DeepEqual(got, []string{"developer", "viewer"}) {
+		t.Fatalf("Implies(developer) = %v", got)
+	}
+}
+
+func TestCustomRole(t *testing.T) {
+	p, err := ParsePolicy([]byte(`{
+		"subjects": {"auditor": ` + auditorRow + `, "viewer": ` + auditorRow + `},
+		"roles": {"auditor": {"inherits": ["viewer"]}, "lead": {"inherits": ["auditor"]}}
+	}`))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	lead := User{ID: "lead", Roles: []string{"lead"}}
+	if err := NewStateTransform("creator", lead, DatasetStateBanned, DatasetActionRead, WithPolicy(p)).Check(); err != nil {
+		t.Fatalf("lead read on banned: unexpected error %v", err)
+	}
+	if err := NewStateTransform("creator", lead, DatasetStateBanned, DatasetActionExec, WithPolicy(p)).Check(); err == nil {
+		t.Fatal("lead exec on banned: expected error, got nil")
+	}
+}
+
+func TestParsePolicyRejectsBadRoles(t *testing.T) {
+	tests := []struct {
+		roles   string
+		wantErr string
+	}{
+		{`{"a": {"inherits": ["b"]}, "b": {"inherits": ["a"]}}`, "inherits itself"},
+		{`{"a": {"inherits": ["nobody"]}}`, `inherits unknown role "nobody"`},
+		{`{"a": {"inherits": ["creator"]}}`, `inherits unknown role "creator"`},
+		{`{"creator": {}}`, `invalid role name "creator"`},
+		{`{"a": {"inherits": ["auditor", "auditor"]}}`, "twice"},
+	}
+	for _, test := range tests {
+		_, err := ParsePolicy([]byte(`{"subjects": {"auditor": ` + auditorRow + `}, "roles": ` + test.roles + `}`))
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Fatalf("roles %s: expected error containing %q, got %v", test.roles, test.wantErr, err)
+		}
+	}
+}
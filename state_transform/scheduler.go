@@ -0,0 +1,265 @@
+package state_transform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobKind is the kind of transition a Scheduler applies.
+type JobKind string
+
+const (
+	// JobPublish publishes a dataset at Job.At.
+	JobPublish JobKind = "publish"
+	// JobLiftBan reports a temporary ban that ended by restoring the state
+	// the dataset had before it was banned. Lifts are not queued; the ban
+	// is stored on the dataset record and RunDue lifts expired bans on
+	// every call.
+	JobLiftBan JobKind = "lift_ban"
+	// JobPurge reports a deleted dataset removed from the repository because
+	// its tombstone expired. Purges are not scheduled; RunDue performs them
+	// on every call.
+	JobPurge JobKind = "purge"
+)
+
+// Job is a transition waiting for its time.
+type Job struct {
+	ID        uint64
+	Kind      JobKind
+	DatasetID string
+	At        time.Time
+	Operator  User
+
+	// Restore and Revision are set for JobLiftBan: the state the dataset
+	// goes back to and the revision the ban produced.
+	Restore  DatasetState
+	Revision uint64
+
+	opts []Option
+}
+
+// TemporaryBan is stored on the record of a dataset banned with
+// Scheduler.BanUntil. Once Until has passed, the ban lifts and the dataset
+// returns to Restore.
+type TemporaryBan struct {
+	Until      time.Time    `json:"until"`
+	Restore    DatasetState `json:"restore"`
+	OperatorID string       `json:"operator_id"`
+}
+
+// Expired reports whether the ban has ended at now.
+func (b TemporaryBan) Expired(now time.Time) bool {
+	return !now.Before(b.Until)
+}
+
+// withBanExpiry makes a Repository store a ban applied by the checker as a
+// TemporaryBan ending at until.
+func withBanExpiry(until time.Time) Option {
+	return func(s *StateTransform) {
+		s.banUntil = until
+	}
+}
+
+// JobResult is the outcome of running a due job.
+type JobResult struct {
+	Job    Job
+	Record DatasetRecord
+	Err    error
+}
+
+// Scheduler applies time-bound transitions to a Repository: publishes
+// scheduled for later, temporary bans that lift themselves and the purge of
+// deleted datasets whose retention ended. Jobs run when RunDue is called at
+// or after their time, either directly or from Run.
+//
+// Scheduled publishes are kept in memory and lost with the scheduler.
+// Temporary bans and tombstones are stored on the dataset records, so any
+// scheduler for the repository lifts and purges them, even after a restart.
+type Scheduler struct {
+	repo  Repository
+	clock Clock
+	opts  []Option
+
+	mu     sync.Mutex
+	nextID uint64
+	jobs   map[uint64]Job
+}
+
+// NewScheduler returns a scheduler for repo. opts are used for every check
+// the scheduler runs and should match the options repo was created with.
+func NewScheduler(repo Repository, clock Clock, opts ...Option) *Scheduler {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &Scheduler{repo: repo, clock: clock, opts: opts, jobs: make(map[uint64]Job)}
+}
+
+// SchedulePublish publishes the dataset at the given time. The request is
+// checked against the dataset's current state as if it were already at, so
+// scheduling before an embargo ends, whether stored on the record or given
+// in opts, fails with ErrEmbargoed. The precheck is not journaled; the
+// policy is checked and journaled when the job runs.
+func (s *Scheduler) SchedulePublish(datasetID string, operator User, at time.Time, opts ...Option) (Job, error) {
+	rec, err := s.repo.Get(datasetID)
+	if err != nil {
+		return Job{}, err
+	}
+	opts = append(append([]Option(nil), s.opts...), opts...)
+	checkOpts := append(append([]Option(nil), opts...), WithClock(fixedClock(at)))
+	if rec.Embargo != nil {
+		checkOpts = append(checkOpts, withStoredEmbargo(*rec.Embargo))
+	}
+	if err := newStateTransform(rec.CreatorID, operator, rec.State, DatasetActionPublish, checkOpts...).check(); err != nil {
+		return Job{}, err
+	}
+	return s.add(Job{Kind: JobPublish, DatasetID: datasetID, At: at, Operator: operator, opts: opts}), nil
+}
+
+// BanUntil bans the dataset now and stores on its record that the ban lifts
+// at until. The returned job describes the lift; it is not pending and
+// cannot be cancelled, but any other change of the dataset's state drops
+// the lift.
+func (s *Scheduler) BanUntil(datasetID string, operator User, until time.Time, opts ...Option) (Job, error) {
+	if !until.After(s.clock.Now()) {
+		return Job{}, errors.New("ban must end in the future")
+	}
+	rec, err := s.repo.Get(datasetID)
+	if err != nil {
+		return Job{}, err
+	}
+	if rec.State == DatasetStateBanned {
+		return Job{}, fmt.Errorf("dataset %s is already banned", datasetID)
+	}
+	opts = append(append([]Option(nil), s.opts...), opts...)
+	banned, err := s.repo.Apply(datasetID, rec.Revision, operator, DatasetActionBan, append(opts, WithClock(s.clock), withBanExpiry(until))...)
+	if err != nil {
+		return Job{}, err
+	}
+	return Job{
+		Kind:      JobLiftBan,
+		DatasetID: datasetID,
+		At:        until,
+		Operator:  operator,
+		Restore:   rec.State,
+		Revision:  banned.Revision,
+	}, nil
+}
+
+func (s *Scheduler) add(job Job) Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	job.ID = s.nextID
+	s.jobs[job.ID] = job
+	return job
+}
+
+// Cancel removes a pending job and reports whether it was found.
+func (s *Scheduler) Cancel(id uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.jobs[id]
+	delete(s.jobs, id)
+	return ok
+}
+
+// Pending returns every job that has not run yet, earliest first.
+func (s *Scheduler) Pending() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sortJobs(jobs)
+	return jobs
+}
+
+// RunDue runs every job whose time has come, earliest first, then lifts
+// expired bans and purges expired tombstones, and returns the results. A
+// job runs once even if it fails.
+func (s *Scheduler) RunDue() []JobResult {
+	now := s.clock.Now()
+	s.mu.Lock()
+	var due []Job
+	for id, job := range s.jobs {
+		if !job.At.After(now) {
+			due = append(due, job)
+			delete(s.jobs, id)
+		}
+	}
+	s.mu.Unlock()
+
+	sortJobs(due)
+	results := make([]JobResult, 0, len(due))
+	for _, job := range due {
+		rec, err := s.run(job)
+		results = append(results, JobResult{Job: job, Record: rec, Err: err})
+	}
+
+	lifted, err := s.repo.LiftExpiredBans(now)
+	for _, rec := range lifted {
+		job := Job{Kind: JobLiftBan, DatasetID: rec.ID, At: now, Restore: rec.State, Revision: rec.Revision - 1}
+		results = append(results, JobResult{Job: job, Record: rec})
+	}
+	if err != nil {
+		results = append(results, JobResult{Job: Job{Kind: JobLiftBan, At: now}, Err: err})
+	}
+
+	purged, err := s.repo.PurgeExpired(now)
+	if err != nil {
+		results = append(results, JobResult{Job: Job{Kind: JobPurge, At: now}, Err: err})
+	}
+	for _, rec := range purged {
+		results = append(results, JobResult{Job: Job{Kind: JobPurge, DatasetID: rec.ID, At: now}, Record: rec})
+	}
+	return results
+}
+
+func (s *Scheduler) run(job Job) (DatasetRecord, error) {
+	switch job.Kind {
+	case JobPublish:
+		rec, err := s.repo.Get(job.DatasetID)
+		if err != nil {
+			return rec, err
+		}
+		return s.repo.Apply(job.DatasetID, rec.Revision, job.Operator, DatasetActionPublish, append(job.opts, WithClock(s.clock))...)
+	default:
+		return DatasetRecord{}, fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+}
+
+// Run calls RunDue every interval until ctx is done, passing each result to
+// report if it is not nil.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration, report func(JobResult)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, result := range s.RunDue() {
+				if report != nil {
+					report(result)
+				}
+			}
+		}
+	}
+}
+
+func sortJobs(jobs []Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].At.Equal(jobs[j].At) {
+			return jobs[i].At.Before(jobs[j].At)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+}
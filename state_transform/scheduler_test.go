@@ -0,0 +1,208 @@
+package state_transform
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestEmbargo(t *testing.T) {
+	clock := newFakeClock()
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	embargo := clock.Now().Add(time.Hour)
+	check := func() error {
+		return NewStateTransform(creator.ID, creator, DatasetStateDevelopment, DatasetActionPublish, WithClock(clock), WithEmbargo(embargo)).Check()
+	}
+
+	if err := check(); !errors.Is(err, ErrEmbargoed) {
+		t.Fatalf("expected ErrEmbargoed, got %v", err)
+	}
+	if err := NewStateTransform(creator.ID, creator, DatasetStateDevelopment, DatasetActionModify, WithClock(clock), WithEmbargo(embargo)).Check(); err != nil {
+		t.Fatalf("embargo must only block publish: %v", err)
+	}
+	clock.Advance(time.Hour)
+	if err := check(); err != nil {
+		t.Fatalf("publish after embargo: %v", err)
+	}
+}
+
+func TestSchedulerPublish(t *testing.T) {
+	clock := newFakeClock()
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	repo := NewMemoryRepository()
+	rec, _ := repo.Create("ds", creator.ID)
+	if _, err := repo.Apply("ds", rec.Revision, creator, DatasetActionDevelop); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScheduler(repo, clock)
+	embargo := clock.Now().Add(2 * time.Hour)
+	if _, err := s.SchedulePublish("ds", creator, clock.Now().Add(time.Hour), WithEmbargo(embargo)); !errors.Is(err, ErrEmbargoed) {
+		t.Fatalf("scheduling inside the embargo: expected ErrEmbargoed, got %v", err)
+	}
+	job, err := s.SchedulePublish("ds", creator, embargo, WithEmbargo(embargo))
+	if err != nil {
+		t.Fatalf("schedule publish: %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	if results := s.RunDue(); len(results) != 0 {
+		t.Fatalf("expected no due jobs, got %+v", results)
+	}
+	clock.Advance(time.Hour)
+	results := s.RunDue()
+	if len(results) != 1 || results[0].Job.ID != job.ID || results[0].Err != nil || results[0].Record.State != DatasetStateReleased {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if len(s.Pending()) != 0 {
+		t.Fatalf("expected no pending jobs, got %+v", s.Pending())
+	}
+}
+
+func TestSchedulerTemporaryBan(t *testing.T) {
+	clock := newFakeClock()
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	journal := NewJournal(nil)
+	hooks := NewHooks(RetryPolicy{})
+	var notified recorder
+	hooks.Subscribe("notified", notified.hook)
+	path := filepath.Join(t.TempDir(), "datasets.json")
+	repo, err := OpenFileRepository(path, WithJournal(journal), WithHooks(hooks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, _ := repo.Create("ds", "creator")
+	rec, _ = repo.Apply("ds", rec.Revision, admin, DatasetActionDevelop)
+	if _, err := repo.Apply("ds", rec.Revision, admin, DatasetActionPublish); err != nil {
+		t.Fatal(err)
+	}
+
+	until := clock.Now().Add(24 * time.Hour)
+	job, err := NewScheduler(repo, clock).BanUntil("ds", admin, until)
+	if err != nil {
+		t.Fatalf("ban: %v", err)
+	}
+	if _, err := NewScheduler(repo, clock).BanUntil("ds", admin, until); err == nil {
+		t.Fatalf("expected banning a banned dataset to fail")
+	}
+
+	// The lift is stored with the dataset, so a new scheduler over the
+	// reopened repository still performs it.
+	repo, err = OpenFileRepository(path, WithJournal(journal), WithHooks(hooks))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, _ = repo.Get("ds")
+	want := TemporaryBan{Until: until, Restore: DatasetStateReleased, OperatorID: admin.ID}
+	if rec.State != DatasetStateBanned || rec.Ban == nil || !rec.Ban.Until.Equal(until) || rec.Ban.Restore != want.Restore || rec.Ban.OperatorID != want.OperatorID {
+		t.Fatalf("expected a stored ban %+v, got %+v", want, rec)
+	}
+	s := NewScheduler(repo, clock)
+	if len(s.Pending()) != 0 {
+		t.Fatalf("expected the lift not to be pending, got %+v", s.Pending())
+	}
+	clock.Advance(time.Hour)
+	if results := s.RunDue(); len(results) != 0 {
+		t.Fatalf("expected no due jobs, got %+v", results)
+	}
+	clock.Advance(23 * time.Hour)
+	results := s.RunDue()
+	if len(results) != 1 || results[0].Err != nil || results[0].Job.Kind != JobLiftBan || results[0].Job.Revision != job.Revision ||
+		results[0].Record.State != DatasetStateReleased || results[0].Record.Ban != nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+
+	entry := journal.Entries()[len(journal.Entries())-1]
+	if entry.Outcome != OutcomeExpired || entry.From != DatasetStateBanned || entry.To != DatasetStateReleased || entry.OperatorID != admin.ID || !entry.Time.Equal(until) {
+		t.Fatalf("unexpected lift entry %+v", entry)
+	}
+	if err := journal.Verify(); err != nil {
+		t.Fatal(err)
+	}
+	hooks.Close()
+	events := notified.received()
+	if e := events[len(events)-1]; !e.Expired || e.Action != DatasetActionBan || e.From != DatasetStateBanned || e.To != DatasetStateReleased || e.Revision != results[0].Record.Revision {
+		t.Fatalf("unexpected lift event %+v", e)
+	}
+
+	// A ban superseded by another change must not be lifted.
+	job, err = s.BanUntil("ds", admin, clock.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Apply("ds", job.Revision, admin, DatasetActionDelete); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	if results := s.RunDue(); len(results) != 0 {
+		t.Fatalf("expected no due jobs, got %+v", results)
+	}
+	if rec, _ := repo.Get("ds"); rec.State != DatasetStateDeleted || rec.Ban != nil {
+		t.Fatalf("expected dataset to stay deleted without a ban, got %+v", rec)
+	}
+}
+
+func TestStoredEmbargo(t *testing.T) {
+	clock := newFakeClock()
+	journal := NewJournal(nil)
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	repo := NewMemoryRepository(WithClock(clock), WithJournal(journal))
+	rec, _ := repo.Create("ds", creator.ID)
+	rec, _ = repo.Apply("ds", rec.Revision, creator, DatasetActionDevelop)
+	embargo := clock.Now().Add(2 * time.Hour)
+	rec, err := repo.SetEmbargo("ds", rec.Revision, embargo)
+	if err != nil || rec.Embargo == nil || !rec.Embargo.Equal(embargo) {
+		t.Fatalf("set embargo: %+v, %v", rec, err)
+	}
+
+	if _, err := repo.Apply("ds", rec.Revision, creator, DatasetActionPublish); !errors.Is(err, ErrEmbargoed) {
+		t.Fatalf("plain publish: expected ErrEmbargoed, got %v", err)
+	}
+	if _, err := repo.Apply("ds", rec.Revision, creator, DatasetActionPublish, WithEmbargo(clock.Now())); !errors.Is(err, ErrEmbargoed) {
+		t.Fatalf("publish with a shorter embargo: expected ErrEmbargoed, got %v", err)
+	}
+
+	s := NewScheduler(repo, clock)
+	entries := len(journal.Entries())
+	if _, err := s.SchedulePublish("ds", creator, clock.Now().Add(time.Hour)); !errors.Is(err, ErrEmbargoed) {
+		t.Fatalf("scheduling inside the stored embargo: expected ErrEmbargoed, got %v", err)
+	}
+	if _, err := s.SchedulePublish("ds", creator, embargo); err != nil {
+		t.Fatalf("schedule publish: %v", err)
+	}
+	if n := len(journal.Entries()); n != entries {
+		t.Fatalf("scheduling journaled %d entries", n-entries)
+	}
+
+	clock.Advance(2 * time.Hour)
+	results := s.RunDue()
+	if len(results) != 1 || results[0].Err != nil || results[0].Record.State != DatasetStateReleased {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if e := journal.Entries()[len(journal.Entries())-1]; e.Action != DatasetActionPublish || e.Outcome != OutcomeAllowed || !e.Time.Equal(embargo) {
+		t.Fatalf("unexpected publish entry %+v", e)
+	}
+}
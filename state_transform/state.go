@@ -1,21 +1,244 @@
 package state_transform
 
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
 type StateTransform struct {
 	creatorID string
 	operator  User
 	state     DatasetState
 	action    DatasetAction
+	policy    *Policy
+	journal   *Journal
+	grants    []Grant
+	clock     Clock
+	embargo   time.Time
+	banUntil  time.Time
+
+	requireApproval bool
+	approved        bool
+
+	tombstone *Tombstone
+	retention time.Duration
+
+	tenant string
+	public bool
+
+	hooks     *Hooks
+	datasetID string
+	version   int
+}
+
+// Option configures a StateTransform.
+type Option func(*StateTransform)
+
+// WithPolicy makes the checker evaluate p instead of DefaultPolicy().
+func WithPolicy(p *Policy) Option {
+	return func(s *StateTransform) {
+		if p != nil {
+			s.policy = p
+		}
+	}
+}
+
+func NewStateTransform(creatorID string, operator User, state DatasetState, action DatasetAction, opts ...Option) StateChecker {
+	return newStateTransform(creatorID, operator, state, action, opts...)
 }
 
-func NewStateTransform(creatorID string, operator User, state DatasetState, action DatasetAction) StateChecker {
-	return &StateTransform{
+func newStateTransform(creatorID string, operator User, state DatasetState, action DatasetAction, opts ...Option) *StateTransform {
+	s := &StateTransform{
 		creatorID: creatorID,
 		operator:  operator,
 		state:     state,
 		action:    action,
+		policy:    DefaultPolicy(),
+		clock:     SystemClock,
+		retention: DefaultRetention,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *StateTransform) Check() error {
+	err := s.check()
+	if jerr := s.record(err); jerr != nil {
+		return errors.Join(err, jerr)
+	}
+	return err
+}
+
+func (s *StateTransform) check() error {
+	return s.evaluate(nil)
+}
+
+// evaluate decides the transform, recording every rule it looks at in t.
+func (s *StateTransform) evaluate(t *trace) error {
+	if !s.state.Valid() {
+		t.add("input", StepFailed, "state %d is not a dataset state", int(s.state))
+		t.decide()
+		return fmt.Errorf("%w: %d", ErrInvalidState, int(s.state))
+	}
+	if !s.action.Valid() {
+		t.add("input", StepFailed, "action %d is not a dataset action", int(s.action))
+		t.decide()
+		return fmt.Errorf("%w: %d", ErrInvalidAction, int(s.action))
+	}
+	t.add("input", StepPassed, "state %s and action %s are valid", s.state, s.action)
+
+	if s.isCreator() {
+		t.add("creator", StepMatched, "operator %q created the dataset", s.operator.ID)
+	} else {
+		t.add("creator", StepSkipped, "operator %q is not creator %q", s.operator.ID, s.creatorID)
+	}
+	if t != nil {
+		if grants := s.grantSubjects(); len(grants) > 0 {
+			t.add("grants", StepMatched, "operator holds %v", grants)
+		} else {
+			t.add("grants", StepSkipped, "no grant applies to operator %q", s.operator.ID)
+		}
+		t.add("roles", StepPassed, "held %v, effective %v", s.operator.Roles, s.policy.ResolveRoles(s.operator.Roles))
+	}
+
+	for i, c := range s.policy.conditions {
+		if !c.allow && c.when.evalFor(s) {
+			t.add(fmt.Sprintf("condition %d", i), StepDenied, "deny when %s", c.when)
+			t.decide()
+			return s.deny(ReasonConditionDenied)
+		}
+	}
+
+	if s.publicRead() {
+		t.add("public", StepAllowed, "dataset is public and released")
+		t.decide()
+		return s.evaluateGuards(t)
+	}
+	if s.crossTenant() {
+		t.add("tenant", StepDenied, "operator of tenant %q may not access datasets of tenant %q", s.operator.Tenant, s.tenant)
+		t.decide()
+		return s.deny(ReasonCrossTenant)
+	}
+	if s.tenant != "" {
+		t.add("tenant", StepPassed, "operator may access tenant %q", s.tenant)
+	}
+
+	for _, subject := range s.subjects() {
+		if s.policy.Allowed(subject, s.state, s.action) {
+			t.add("policy "+subject, StepAllowed, "%s may %s in state %s", subject, s.action, s.state)
+			t.decide()
+			return s.evaluateGuards(t)
+		}
+		t.add("policy "+subject, StepDenied, "%s may not %s in state %s", subject, s.action, s.state)
+	}
+	for i, c := range s.policy.conditions {
+		if c.allow && c.when.evalFor(s) {
+			t.add(fmt.Sprintf("condition %d", i), StepAllowed, "allow when %s", c.when)
+			t.decide()
+			return s.evaluateGuards(t)
+		}
+	}
+	reason := s.denialReason()
+	t.add("default", StepDenied, "no matching subject allows the action (%s)", reason)
+	t.decide()
+	return s.deny(reason)
+}
+
+// evaluateGuards applies the time-bound, retention and approval rules to an
+// action the policy allows.
+func (s *StateTransform) evaluateGuards(t *trace) error {
+	if s.embargoed() {
+		t.add("embargo", StepDenied, "publishing is embargoed until %s", s.embargo.Format(time.RFC3339))
+		t.decide()
+		return s.deny(ReasonEmbargoed)
+	}
+	if s.action == DatasetActionPublish && !s.embargo.IsZero() {
+		t.add("embargo", StepPassed, "embargo ended at %s", s.embargo.Format(time.RFC3339))
+	}
+	if s.missingTombstone() {
+		t.add("retention", StepDenied, "restoring needs the tombstone of the deleted dataset")
+		t.decide()
+		return s.deny(ReasonTombstoneRequired)
+	}
+	if s.retentionExpired() {
+		t.add("retention", StepDenied, "tombstone expired at %s", s.tombstone.PurgeAfter.Format(time.RFC3339))
+		t.decide()
+		return s.deny(ReasonRetentionExpired)
+	}
+	if s.action == DatasetActionPublish && s.requireApproval {
+		if !s.approved {
+			t.add("approval", StepDenied, "publishing requires an approved request")
+			t.decide()
+			return s.deny(ReasonApprovalRequired)
+		}
+		t.add("approval", StepPassed, "publish request was approved")
+	}
 	return nil
 }
+
+func (s *StateTransform) deny(reason DenialReason) *DenialError {
+	return &DenialError{
+		State:      s.state,
+		Action:     s.action,
+		OperatorID: s.operator.ID,
+		Reason:     reason,
+	}
+}
+
+// denialReason picks the most specific explanation for a denied action, in
+// this order: the dataset is banned; no subject may perform the action in
+// this state; the operator is known to the policy and the creator could have
+// performed it (not_creator); otherwise some other subject could have
+// (role_forbidden).
+func (s *StateTransform) denialReason() DenialReason {
+	if s.state == DatasetStateBanned {
+		return ReasonDatasetBanned
+	}
+	allowedBySomeone := false
+	for _, subject := range s.policy.Subjects() {
+		if s.policy.Allowed(subject, s.state, s.action) {
+			allowedBySomeone = true
+			break
+		}
+	}
+	if !allowedBySomeone {
+		return ReasonStateForbidden
+	}
+	known := false
+	for _, subject := range s.subjects() {
+		if s.policy.HasSubject(subject) {
+			known = true
+			break
+		}
+	}
+	if known && s.policy.Allowed(SubjectCreator, s.state, s.action) {
+		return ReasonNotCreator
+	}
+	return ReasonRoleForbidden
+}
+
+// subjects lists the policy subjects the operator matches: the creator
+// relationship first, then the dataset grants that apply to the operator,
+// then every role the operator holds or inherits, in the order
+// Policy.ResolveRoles returns them.
+func (s *StateTransform) subjects() []string {
+	grants := s.grantSubjects()
+	roles := s.policy.ResolveRoles(s.operator.Roles)
+	subjects := make([]string, 0, len(grants)+len(roles)+1)
+	if s.isCreator() {
+		subjects = append(subjects, SubjectCreator)
+	}
+	for _, g := range grants {
+		if g != SubjectCreator || !s.isCreator() {
+			subjects = append(subjects, g)
+		}
+	}
+	return append(subjects, roles...)
+}
+
+func (s *StateTransform) isCreator() bool {
+	return s.creatorID != "" && s.operator.ID == s.creatorID
+}
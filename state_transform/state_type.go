@@ -1,5 +1,7 @@
 package state_transform
 
+import "fmt"
+
 type DatasetState int
 
 const (
@@ -8,8 +10,52 @@ const (
 	DatasetStateReleased    DatasetState = 2
 	DatasetStateOutdated    DatasetState = 3
 	DatasetStateBanned      DatasetState = 4
+	// DatasetStateDeleted is a soft-deleted dataset kept as a tombstone
+	// until its retention window ends.
+	DatasetStateDeleted DatasetState = 5
 )
 
+var datasetStateNames = [...]string{
+	DatasetStateInvalid:     "invalid",
+	DatasetStateDevelopment: "development",
+	DatasetStateReleased:    "released",
+	DatasetStateOutdated:    "outdated",
+	DatasetStateBanned:      "banned",
+	DatasetStateDeleted:     "deleted",
+}
+
+const datasetStateCount = len(datasetStateNames)
+
+func (s DatasetState) Valid() bool {
+	return s >= 0 && int(s) < datasetStateCount
+}
+
+func (s DatasetState) String() string {
+	if !s.Valid() {
+		return fmt.Sprintf("DatasetState(%d)", int(s))
+	}
+	return datasetStateNames[s]
+}
+
+// ParseDatasetState returns the state whose String() is name.
+func ParseDatasetState(name string) (DatasetState, error) {
+	for i, n := range datasetStateNames {
+		if n == name {
+			return DatasetState(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dataset state %q", name)
+}
+
+// AllDatasetStates returns every defined state in ascending order.
+func AllDatasetStates() []DatasetState {
+	states := make([]DatasetState, datasetStateCount)
+	for i := range states {
+		states[i] = DatasetState(i)
+	}
+	return states
+}
+
 type DatasetAction int
 
 const (
@@ -21,13 +67,66 @@ const (
 	DatasetActionModify  DatasetAction = 5
 	DatasetActionRead    DatasetAction = 6
 	DatasetActionExec    DatasetAction = 7
+	// DatasetActionRestore brings a deleted dataset back while its
+	// tombstone is retained.
+	DatasetActionRestore DatasetAction = 8
 )
 
+var datasetActionNames = [...]string{
+	DatasetActionDevelop: "develop",
+	DatasetActionPublish: "publish",
+	DatasetActionOutdate: "outdate",
+	DatasetActionBan:     "ban",
+	DatasetActionDelete:  "delete",
+	DatasetActionModify:  "modify",
+	DatasetActionRead:    "read",
+	DatasetActionExec:    "exec",
+	DatasetActionRestore: "restore",
+}
+
+const datasetActionCount = len(datasetActionNames)
+
+func (a DatasetAction) Valid() bool {
+	return a >= 0 && int(a) < datasetActionCount
+}
+
+func (a DatasetAction) String() string {
+	if !a.Valid() {
+		return fmt.Sprintf("DatasetAction(%d)", int(a))
+	}
+	return datasetActionNames[a]
+}
+
+// ParseDatasetAction returns the action whose String() is name.
+func ParseDatasetAction(name string) (DatasetAction, error) {
+	for i, n := range datasetActionNames {
+		if n == name {
+			return DatasetAction(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown dataset action %q", name)
+}
+
+// AllDatasetActions returns every defined action in ascending order.
+func AllDatasetActions() []DatasetAction {
+	actions := make([]DatasetAction, datasetActionCount)
+	for i := range actions {
+		actions[i] = DatasetAction(i)
+	}
+	return actions
+}
+
 type User struct {
-	ID    string
-	Roles []string
+	ID     string
+	Roles  []string
+	Groups []string
+	// Tenant is the organization the user belongs to. Roles only apply to
+	// datasets of the same tenant, see WithTenant.
+	Tenant string
 }
 
 type StateChecker interface {
 	Check() error
+	Transition() (DatasetState, error)
+	Explain() Decision
 }
@@ -0,0 +1,42 @@
+package state_transform
+
+import "slices"
+
+// RoleSuperadmin is the platform-wide administrator role. Operators holding
+// it, directly or through inheritance, are not bound to a tenant.
+const RoleSuperadmin = "superadmin"
+
+// WithTenant places the dataset in tenant. Once a dataset has a tenant only
+// operators of the same tenant, and superadmins, are evaluated against the
+// policy; everyone else may at most read it, see WithPublic. Datasets
+// without a tenant are not scoped.
+func WithTenant(tenant string) Option {
+	return func(s *StateTransform) {
+		s.tenant = tenant
+	}
+}
+
+// WithPublic marks the dataset as public, which lets every operator, of any
+// tenant and with any roles, read it while it is Released. Deny conditions
+// still apply.
+func WithPublic(public bool) Option {
+	return func(s *StateTransform) {
+		s.public = public
+	}
+}
+
+// crossTenant reports whether the operator acts on a dataset of a tenant
+// they do not belong to.
+func (s *StateTransform) crossTenant() bool {
+	return s.tenant != "" && s.operator.Tenant != s.tenant && !s.isSuperadmin()
+}
+
+// publicRead reports whether the action is a read of a public release,
+// which anyone may do and the only thing other tenants may do.
+func (s *StateTransform) publicRead() bool {
+	return s.public && s.state == DatasetStateReleased && s.action == DatasetActionRead
+}
+
+func (s *StateTransform) isSuperadmin() bool {
+	return slices.Contains(s.policy.ResolveRoles(s.operator.Roles), RoleSuperadmin)
+}
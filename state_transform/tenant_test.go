@@ -0,0 +1,55 @@
+package state_transform
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTenantScoping(t *testing.T) {
+	tests := []struct {
+		name     string
+		operator User
+		state    DatasetState
+		action   DatasetAction
+		opts     []Option
+		wantErr  error
+	}{
+		{"tenant admin", User{ID: "a", Roles: []string{"admin"}, Tenant: "acme"}, DatasetStateReleased, DatasetActionBan, []Option{WithTenant("acme")}, nil},
+		{"foreign admin", User{ID: "g", Roles: []string{"admin"}, Tenant: "globex"}, DatasetStateReleased, DatasetActionBan, []Option{WithTenant("acme")}, ErrCrossTenant},
+		{"admin without tenant", User{ID: "n", Roles: []string{"admin"}}, DatasetStateReleased, DatasetActionBan, []Option{WithTenant("acme")}, ErrCrossTenant},
+		{"superadmin", User{ID: "s", Roles: []string{RoleSuperadmin}}, DatasetStateReleased, DatasetActionBan, []Option{WithTenant("acme")}, nil},
+		{"foreign creator", User{ID: "creator", Roles: []string{"developer"}, Tenant: "globex"}, DatasetStateDevelopment, DatasetActionModify, []Option{WithTenant("acme")}, ErrCrossTenant},
+		{"public read", User{ID: "g", Tenant: "globex"}, DatasetStateReleased, DatasetActionRead, []Option{WithTenant("acme"), WithPublic(true)}, nil},
+		{"public read in tenant", User{ID: "a", Tenant: "acme"}, DatasetStateReleased, DatasetActionRead, []Option{WithTenant("acme"), WithPublic(true)}, nil},
+		{"private read in tenant", User{ID: "a", Tenant: "acme"}, DatasetStateReleased, DatasetActionRead, []Option{WithTenant("acme")}, ErrRoleForbidden},
+		{"private read", User{ID: "g", Roles: []string{"viewer"}, Tenant: "globex"}, DatasetStateReleased, DatasetActionRead, []Option{WithTenant("acme")}, ErrCrossTenant},
+		{"public outdated read", User{ID: "g", Roles: []string{"viewer"}, Tenant: "globex"}, DatasetStateOutdated, DatasetActionRead, []Option{WithTenant("acme"), WithPublic(true)}, ErrCrossTenant},
+		{"public exec", User{ID: "g", Roles: []string{"viewer"}, Tenant: "globex"}, DatasetStateReleased, DatasetActionExec, []Option{WithTenant("acme"), WithPublic(true)}, ErrCrossTenant},
+		{"unscoped dataset", User{ID: "g", Roles: []string{"admin"}, Tenant: "globex"}, DatasetStateReleased, DatasetActionBan, nil, nil},
+	}
+	for _, test := range tests {
+		err := NewStateTransform("creator", test.operator, test.state, test.action, test.opts...).Check()
+		if test.wantErr == nil && err != nil {
+			t.Fatalf("%s: unexpected error %v", test.name, err)
+		}
+		if test.wantErr != nil && (!errors.Is(err, test.wantErr) || !errors.Is(err, ErrPermissionDenied)) {
+			t.Fatalf("%s: expected %v, got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestTenantConditionAndExplain(t *testing.T) {
+	p, err := ParsePolicy([]byte(`{"subjects": {"auditor": ` + auditorRow + `}, "conditions": [{"effect": "deny", "when": "operator.tenant == \"sandbox\""}]}`))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	sandbox := User{ID: "x", Roles: []string{"auditor"}, Tenant: "sandbox"}
+	if err := NewStateTransform("creator", sandbox, DatasetStateBanned, DatasetActionRead, WithPolicy(p)).Check(); !errors.Is(err, ErrConditionDenied) {
+		t.Fatalf("expected ErrConditionDenied, got %v", err)
+	}
+
+	d := NewStateTransform("creator", User{ID: "g", Tenant: "globex"}, DatasetStateReleased, DatasetActionRead, WithTenant("acme"), WithPublic(true)).Explain()
+	if !d.Allowed || d.Steps[d.DecidedBy].Rule != "public" {
+		t.Fatalf("expected the public rule to decide, got %s", d)
+	}
+}
@@ -0,0 +1,63 @@
+package state_transform
+
+import "time"
+
+// DefaultRetention is how long a deleted dataset can be restored before it
+// is purged, unless WithRetention says otherwise.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// Tombstone is kept for a soft-deleted dataset. It remembers the state the
+// dataset was deleted from, so restoring cannot launder a ban, and when the
+// retention window ends.
+type Tombstone struct {
+	DeletedAt   time.Time    `json:"deleted_at"`
+	DeletedFrom DatasetState `json:"deleted_from"`
+	PurgeAfter  time.Time    `json:"purge_after"`
+}
+
+// Expired reports whether the retention window has ended at now.
+func (t Tombstone) Expired(now time.Time) bool {
+	return !now.Before(t.PurgeAfter)
+}
+
+// WithTombstone tells the checker about the tombstone of a deleted dataset.
+// Restore is denied without it, and once it has expired, and otherwise
+// returns the dataset to the state it was deleted from.
+func WithTombstone(t Tombstone) Option {
+	return func(s *StateTransform) {
+		s.tombstone = &t
+	}
+}
+
+// WithRetention sets how long tombstones created by a delete are kept.
+func WithRetention(d time.Duration) Option {
+	return func(s *StateTransform) {
+		s.retention = d
+	}
+}
+
+// nextState is NextState with the tombstone taken into account.
+func (s *StateTransform) nextState() DatasetState {
+	if s.action == DatasetActionRestore && s.state == DatasetStateDeleted && s.tombstone != nil {
+		return s.tombstone.DeletedFrom
+	}
+	return NextState(s.state, s.action)
+}
+
+// newTombstone returns the tombstone a delete performed now leaves behind.
+func (s *StateTransform) newTombstone() *Tombstone {
+	now := s.clock.Now()
+	return &Tombstone{DeletedAt: now, DeletedFrom: s.state, PurgeAfter: now.Add(s.retention)}
+}
+
+// missingTombstone reports whether a deleted dataset is to be restored
+// without knowing the state it was deleted from. Falling back to Development
+// would let a banned dataset be laundered by deleting and restoring it.
+func (s *StateTransform) missingTombstone() bool {
+	return s.action == DatasetActionRestore && s.state == DatasetStateDeleted && s.tombstone == nil
+}
+
+// retentionExpired reports whether a restore comes too late.
+func (s *StateTransform) retentionExpired() bool {
+	return s.action == DatasetActionRestore && s.tombstone != nil && s.tombstone.Expired(s.clock.Now())
+}
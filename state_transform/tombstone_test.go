@@ -0,0 +1,169 @@
+package state_transform
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTombstoneRestore(t *testing.T) {
+	clock := newFakeClock()
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+
+	// Restoring returns to the state the dataset was deleted from, so a
+	// delete and restore cannot be used to lift a ban.
+	repo := NewMemoryRepository(WithClock(clock), WithRetention(time.Hour))
+	rec, _ := repo.Create("ds", creator.ID)
+	rec, _ = repo.Apply("ds", rec.Revision, creator, DatasetActionDevelop)
+	rec, _ = repo.Apply("ds", rec.Revision, admin, DatasetActionPublish)
+	rec, _ = repo.Apply("ds", rec.Revision, admin, DatasetActionBan)
+	rec, err := repo.Apply("ds", rec.Revision, admin, DatasetActionDelete)
+	if err != nil || rec.State != DatasetStateDeleted || rec.Tombstone == nil {
+		t.Fatalf("delete: %+v, %v", rec, err)
+	}
+	if rec.Tombstone.DeletedFrom != DatasetStateBanned || !rec.Tombstone.PurgeAfter.Equal(clock.Now().Add(time.Hour)) {
+		t.Fatalf("unexpected tombstone %+v", rec.Tombstone)
+	}
+	if _, err := repo.Apply("ds", rec.Revision, User{ID: "other", Roles: []string{"developer"}}, DatasetActionRestore); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("developer restore: expected ErrPermissionDenied, got %v", err)
+	}
+	rec, err = repo.Apply("ds", rec.Revision, creator, DatasetActionRestore)
+	if err != nil || rec.State != DatasetStateBanned || rec.Tombstone != nil {
+		t.Fatalf("restore: %+v, %v", rec, err)
+	}
+
+	// Once the window has passed the dataset can no longer be restored.
+	rec, _ = repo.Apply("ds", rec.Revision, admin, DatasetActionDelete)
+	clock.Advance(time.Hour)
+	if _, err := repo.Apply("ds", rec.Revision, admin, DatasetActionRestore); !errors.Is(err, ErrRetentionExpired) {
+		t.Fatalf("late restore: expected ErrRetentionExpired, got %v", err)
+	}
+
+	// Without a tombstone the state to return to is unknown, so a banned
+	// dataset could come back as Development.
+	if next, err := NewStateTransform("creator", creator, DatasetStateDeleted, DatasetActionRestore).Transition(); !errors.Is(err, ErrNoTombstone) || next != DatasetStateDeleted {
+		t.Fatalf("restore without tombstone: expected ErrNoTombstone, got %s, %v", next, err)
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	clock := newFakeClock()
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+
+	file, err := OpenFileRepository(filepath.Join(t.TempDir(), "datasets.json"), WithClock(clock), WithRetention(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := NewMemoryRepository(WithClock(clock), WithRetention(time.Hour))
+	for name, repo := range map[string]Repository{"memory": memory, "file": file} {
+		for _, id := range []string{"old", "new", "live"} {
+			rec, _ := repo.Create(id, admin.ID)
+			rec, _ = repo.Apply(id, rec.Revision, admin, DatasetActionDevelop)
+			if id == "new" {
+				clock.Advance(30 * time.Minute)
+			}
+			if id != "live" {
+				if _, err := repo.Apply(id, rec.Revision, admin, DatasetActionDelete); err != nil {
+					t.Fatalf("%s: delete %s: %v", name, id, err)
+				}
+			}
+		}
+		clock.Advance(30 * time.Minute)
+
+		purged, err := repo.PurgeExpired(clock.Now())
+		if err != nil || len(purged) != 1 || purged[0].ID != "old" {
+			t.Fatalf("%s: purge: %+v, %v", name, purged, err)
+		}
+		if _, err := repo.Get("old"); !errors.Is(err, ErrDatasetNotFound) {
+			t.Fatalf("%s: expected old to be gone, got %v", name, err)
+		}
+		for _, id := range []string{"new", "live"} {
+			if _, err := repo.Get(id); err != nil {
+				t.Fatalf("%s: %s: %v", name, id, err)
+			}
+		}
+	}
+
+	reopened, err := OpenFileRepository(file.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Get("old"); !errors.Is(err, ErrDatasetNotFound) {
+		t.Fatalf("reopened: expected old to be gone, got %v", err)
+	}
+	if rec, err := reopened.Get("new"); err != nil || rec.Tombstone == nil {
+		t.Fatalf("reopened: tombstone not persisted: %+v, %v", rec, err)
+	}
+}
+
+func TestForceStateTombstone(t *testing.T) {
+	clock := newFakeClock()
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	repo := NewMemoryRepository(WithClock(clock), WithRetention(time.Hour))
+	rec, _ := repo.Create("ds", admin.ID)
+	rec, _ = repo.Apply("ds", rec.Revision, admin, DatasetActionDevelop)
+	rec, _ = repo.Apply("ds", rec.Revision, admin, DatasetActionBan)
+
+	rec, err := repo.ForceState("ds", rec.Revision, DatasetStateDeleted)
+	want := Tombstone{DeletedAt: clock.Now(), DeletedFrom: DatasetStateBanned, PurgeAfter: clock.Now().Add(time.Hour)}
+	if err != nil || rec.Tombstone == nil || *rec.Tombstone != want {
+		t.Fatalf("expected tombstone %+v, got %+v, %v", want, rec, err)
+	}
+	restored, err := repo.Apply("ds", rec.Revision, admin, DatasetActionRestore)
+	if err != nil || restored.State != DatasetStateBanned {
+		t.Fatalf("expected restore to banned, got %+v, %v", restored, err)
+	}
+
+	rec, _ = repo.Apply("ds", restored.Revision, admin, DatasetActionDelete)
+	rec, err = repo.ForceState("ds", rec.Revision, DatasetStateDevelopment)
+	if err != nil || rec.State != DatasetStateDevelopment || rec.Tombstone != nil {
+		t.Fatalf("expected the tombstone to be cleared, got %+v, %v", rec, err)
+	}
+}
+
+func TestSchedulerPurge(t *testing.T) {
+	clock := newFakeClock()
+	admin := User{ID: "admin", Roles: []string{"admin"}}
+	repo := NewMemoryRepository(WithClock(clock))
+	rec, _ := repo.Create("ds", admin.ID)
+	rec, _ = repo.Apply("ds", rec.Revision, admin, DatasetActionDevelop)
+	if _, err := repo.Apply("ds", rec.Revision, admin, DatasetActionDelete); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewScheduler(repo, clock)
+	if results := s.RunDue(); len(results) != 0 {
+		t.Fatalf("expected nothing to purge yet, got %+v", results)
+	}
+	clock.Advance(DefaultRetention)
+	results := s.RunDue()
+	if len(results) != 1 || results[0].Job.Kind != JobPurge || results[0].Job.DatasetID != "ds" || results[0].Err != nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if _, err := repo.Get("ds"); !errors.Is(err, ErrDatasetNotFound) {
+		t.Fatalf("expected ErrDatasetNotFound, got %v", err)
+	}
+}
+
+func TestDatasetDeleteRestore(t *testing.T) {
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	d := NewDataset("ds", creator.ID)
+	v, err := d.NewVersion(creator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Apply(creator, v, DatasetActionDelete); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.Version(v); got.State != DatasetStateDeleted || got.Tombstone == nil {
+		t.Fatalf("delete: %+v", got)
+	}
+	if err := d.Apply(creator, v, DatasetActionRestore); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := d.Version(v); got.State != DatasetStateDevelopment || got.Tombstone != nil {
+		t.Fatalf("restore: %+v", got)
+	}
+}
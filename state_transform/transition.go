@@ -0,0 +1,67 @@
+package state_transform
+
+import "errors"
+
+// actionTargets maps each lifecycle action to the state it moves a dataset
+// into. Actions absent from the map leave the state unchanged.
+var actionTargets = map[DatasetAction]DatasetState{
+	DatasetActionDevelop: DatasetStateDevelopment,
+	DatasetActionPublish: DatasetStateReleased,
+	DatasetActionOutdate: DatasetStateOutdated,
+	DatasetActionBan:     DatasetStateBanned,
+	DatasetActionDelete:  DatasetStateDeleted,
+	DatasetActionRestore: DatasetStateDevelopment,
+}
+
+// NextState returns the state a dataset in state ends up in after action,
+// without checking whether the action is permitted. Read, exec and modify
+// preserve the current state. Restore returns to development here; checkers
+// restore to the state recorded in the dataset's Tombstone and deny restores
+// without one, see WithTombstone.
+func NextState(state DatasetState, action DatasetAction) DatasetState {
+	if target, ok := actionTargets[action]; ok {
+		return target
+	}
+	return state
+}
+
+// Transition checks the action and returns the resulting state. On denial it
+// returns the unchanged current state together with the Check error. When
+// the state changes, the veto hooks run before and the notify hooks after
+// the decision, see WithHooks.
+func (s *StateTransform) Transition() (DatasetState, error) {
+	next, err := s.transition()
+	if err == nil && next != s.state {
+		s.hooks.notify(s.event())
+	}
+	return next, err
+}
+
+// transition is Transition without the notification, for callers that
+// still have to store the new state before announcing it.
+func (s *StateTransform) transition() (DatasetState, error) {
+	return s.commit(s.authorize())
+}
+
+// authorize checks the action and, if it changes the state, asks the veto
+// hooks. Nothing is journaled, so callers deciding several transitions at
+// once can authorize all of them before committing any.
+func (s *StateTransform) authorize() error {
+	err := s.check()
+	if err == nil && s.nextState() != s.state {
+		err = s.hooks.veto(s.event())
+	}
+	return err
+}
+
+// commit journals the outcome err of authorize and returns the resulting
+// state.
+func (s *StateTransform) commit(err error) (DatasetState, error) {
+	if jerr := s.record(err); jerr != nil {
+		err = errors.Join(err, jerr)
+	}
+	if err != nil {
+		return s.state, err
+	}
+	return s.nextState(), nil
+}
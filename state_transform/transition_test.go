@@ -0,0 +1,38 @@
+package state_transform
+
+import "testing"
+
+func TestTransition(t *testing.T) {
+	creator := User{ID: "creator", Roles: []string{"developer"}}
+	normalUser := User{ID: "normalUser", Roles: []string{"developer"}}
+
+	tests := []struct {
+		operator User
+		state    DatasetState
+		action   DatasetAction
+		want     DatasetState
+		wantErr  bool
+	}{
+		{creator, DatasetStateInvalid, DatasetActionDevelop, DatasetStateDevelopment, false},
+		{creator, DatasetStateDevelopment, DatasetActionPublish, DatasetStateReleased, false},
+		{creator, DatasetStateReleased, DatasetActionOutdate, DatasetStateOutdated, false},
+		{creator, DatasetStateOutdated, DatasetActionBan, DatasetStateBanned, false},
+		{creator, DatasetStateBanned, DatasetActionDelete, DatasetStateDeleted, false},
+		{creator, DatasetStateDeleted, DatasetActionRestore, DatasetStateDeleted, true},
+		{normalUser, DatasetStateDeleted, DatasetActionRestore, DatasetStateDeleted, true},
+		{creator, DatasetStateReleased, DatasetActionModify, DatasetStateReleased, false},
+		{creator, DatasetStateBanned, DatasetActionRead, DatasetStateBanned, false},
+		{normalUser, DatasetStateReleased, DatasetActionExec, DatasetStateReleased, false},
+		{creator, DatasetStateOutdated, DatasetActionPublish, DatasetStateOutdated, true},
+		{normalUser, DatasetStateDevelopment, DatasetActionPublish, DatasetStateDevelopment, true},
+	}
+	for i, test := range tests {
+		got, err := NewStateTransform(creator.ID, test.operator, test.state, test.action).Transition()
+		if test.wantErr != (err != nil) {
+			t.Fatalf("test %d: expected error %v, got %v", i, test.wantErr, err)
+		}
+		if got != test.want {
+			t.Fatalf("test %d: expected state %s, got %s", i, test.want, got)
+		}
+	}
+}
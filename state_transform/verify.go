@@ -0,0 +1,264 @@
+package state_transform
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Profile is one kind of operator the verifier evaluates: their relationship
+// to the dataset and the single role they hold. Relationship is
+// SubjectCreator, a grant subject such as "grant:executor", or empty for an
+// unrelated operator. Role is empty for an operator without roles.
+type Profile struct {
+	Relationship string
+	Role         string
+}
+
+// String describes the profile the way a person would, e.g. "creator",
+// "non-creator developer" or "executor grantee viewer".
+func (p Profile) String() string {
+	relationship := "non-creator"
+	switch {
+	case p.Relationship == SubjectCreator:
+		relationship = "creator"
+	case isGrantSubject(p.Relationship):
+		relationship = strings.TrimPrefix(p.Relationship, grantSubjectPrefix) + " grantee"
+	}
+	if p.Role == "" {
+		return relationship + " without roles"
+	}
+	return relationship + " " + p.Role
+}
+
+// IsOwner reports whether the profile has the creator's rights.
+func (p Profile) IsOwner() bool {
+	return p.Relationship == SubjectCreator
+}
+
+// Case is the decision a policy makes for one profile, state and action.
+type Case struct {
+	Profile   Profile
+	State     DatasetState
+	Action    DatasetAction
+	Allowed   bool
+	NextState DatasetState
+	Reason    DenialReason
+}
+
+func (c Case) String() string {
+	verb := "may"
+	if !c.Allowed {
+		verb = "may not"
+	}
+	return fmt.Sprintf("%s %s %s in state %s", c.Profile, verb, c.Action, c.State)
+}
+
+// Enumeration holds the decision for every combination of profile, state
+// and action a policy knows about.
+type Enumeration struct {
+	Profiles []Profile
+	cases    map[Profile]*[datasetStateCount][datasetActionCount]Case
+}
+
+// Enumerate evaluates the policy for every relationship (creator, each grant
+// subject, none) combined with every role (each role the policy knows, none)
+// in every state and for every action. Decisions go through Check, so
+// conditions are applied too, for synthetic operators with the IDs
+// "creator" and "operator" and no groups or tenant. Deleted datasets are
+// assumed to have been deleted from Development and to be restorable.
+func (p *Policy) Enumerate() *Enumeration {
+	e := &Enumeration{
+		Profiles: profiles(p.roleNames()),
+		cases:    make(map[Profile]*[datasetStateCount][datasetActionCount]Case),
+	}
+	for _, profile := range e.Profiles {
+		table := new([datasetStateCount][datasetActionCount]Case)
+		for _, state := range AllDatasetStates() {
+			for _, action := range AllDatasetActions() {
+				table[state][action] = p.decide(profile, state, action)
+			}
+		}
+		e.cases[profile] = table
+	}
+	return e
+}
+
+// profiles combines every relationship (creator, each grant subject, none)
+// with each of roles and with no role.
+func profiles(roles []string) []Profile {
+	relationships := []string{SubjectCreator}
+	for _, level := range grantLevels {
+		if level != GrantCoOwner {
+			relationships = append(relationships, grantSubjectPrefix+string(level))
+		}
+	}
+	relationships = append(relationships, "")
+
+	roles = append(roles[:len(roles):len(roles)], "")
+	var all []Profile
+	for _, relationship := range relationships {
+		for _, role := range roles {
+			all = append(all, Profile{Relationship: relationship, Role: role})
+		}
+	}
+	return all
+}
+
+func (p *Policy) decide(profile Profile, state DatasetState, action DatasetAction) Case {
+	operator := User{ID: "operator"}
+	if profile.Role != "" {
+		operator.Roles = []string{profile.Role}
+	}
+	opts := []Option{WithPolicy(p)}
+	if state == DatasetStateDeleted {
+		opts = append(opts, WithTombstone(Tombstone{DeletedFrom: DatasetStateDevelopment, PurgeAfter: time.Now().Add(DefaultRetention)}))
+	}
+	switch {
+	case profile.Relationship == SubjectCreator:
+		operator.ID = "creator"
+	case isGrantSubject(profile.Relationship):
+		level := GrantLevel(strings.TrimPrefix(profile.Relationship, grantSubjectPrefix))
+		opts = append(opts, WithGrants(Grant{UserID: operator.ID, Level: level}))
+	}
+
+	c := Case{Profile: profile, State: state, Action: action}
+	next, err := NewStateTransform("creator", operator, state, action, opts...).Transition()
+	if err != nil {
+		var denial *DenialError
+		if errors.As(err, &denial) {
+			c.Reason = denial.Reason
+		}
+		return c
+	}
+	c.Allowed = true
+	c.NextState = next
+	return c
+}
+
+// Cases returns every decision, grouped by profile in the order of Profiles,
+// then by state and action.
+func (e *Enumeration) Cases() []Case {
+	cases := make([]Case, 0, len(e.Profiles)*datasetStateCount*datasetActionCount)
+	for _, profile := range e.Profiles {
+		for _, row := range e.cases[profile] {
+			cases = append(cases, row[:]...)
+		}
+	}
+	return cases
+}
+
+// Lookup returns the decision for one combination. ok is false when the
+// profile was not enumerated or the state or action is invalid.
+func (e *Enumeration) Lookup(profile Profile, state DatasetState, action DatasetAction) (c Case, ok bool) {
+	table, ok := e.cases[profile]
+	if !ok || !state.Valid() || !action.Valid() {
+		return Case{}, false
+	}
+	return table[state][action], true
+}
+
+// Invariant is a property every policy is expected to have. Check returns a
+// violation for each counterexample it finds.
+type Invariant struct {
+	Name        string
+	Description string
+	Check       func(*Enumeration) []Violation
+}
+
+// Violation is a counterexample to an invariant.
+type Violation struct {
+	Invariant string
+	Case      Case
+	Detail    string
+}
+
+func (v Violation) String() string {
+	if v.Detail == "" {
+		return fmt.Sprintf("%s: %s", v.Invariant, v.Case)
+	}
+	return fmt.Sprintf("%s: %s (%s)", v.Invariant, v.Case, v.Detail)
+}
+
+// DefaultInvariants returns the invariants Verify checks when given none:
+//
+//   - banned-not-executable: only owners may execute a banned dataset
+//   - invalid-exits-by-develop: develop is the only action that moves a
+//     dataset out of Invalid
+//   - admin-covers-creator: an admin may do everything the creator may,
+//     checked only when the policy has an admin role
+func DefaultInvariants() []Invariant {
+	return []Invariant{
+		{
+			Name:        "banned-not-executable",
+			Description: "banned datasets are never executable by non-owners",
+			Check: forEachCase(func(c Case) bool {
+				return !(c.Allowed && c.State == DatasetStateBanned && c.Action == DatasetActionExec && !c.Profile.IsOwner())
+			}),
+		},
+		{
+			Name:        "invalid-exits-by-develop",
+			Description: "no action leaves Invalid except Develop",
+			Check: forEachCase(func(c Case) bool {
+				return !(c.Allowed && c.State == DatasetStateInvalid && c.NextState != DatasetStateInvalid && c.Action != DatasetActionDevelop)
+			}),
+		},
+		{
+			Name:        "admin-covers-creator",
+			Description: "admins are never less privileged than creators",
+			Check:       checkAdminCoversCreator,
+		},
+	}
+}
+
+// forEachCase turns a predicate every single decision must satisfy into an
+// invariant check.
+func forEachCase(ok func(Case) bool) func(*Enumeration) []Violation {
+	return func(e *Enumeration) []Violation {
+		var violations []Violation
+		for _, c := range e.Cases() {
+			if !ok(c) {
+				violations = append(violations, Violation{Case: c})
+			}
+		}
+		return violations
+	}
+}
+
+func checkAdminCoversCreator(e *Enumeration) []Violation {
+	creator := Profile{Relationship: SubjectCreator}
+	admin := Profile{Role: "admin"}
+	if _, ok := e.cases[admin]; !ok {
+		return nil
+	}
+	var violations []Violation
+	for _, state := range AllDatasetStates() {
+		for _, action := range AllDatasetActions() {
+			c, _ := e.Lookup(creator, state, action)
+			a, _ := e.Lookup(admin, state, action)
+			if c.Allowed && !a.Allowed {
+				violations = append(violations, Violation{Case: a, Detail: "the creator may"})
+			}
+		}
+	}
+	return violations
+}
+
+// Verify enumerates the policy and checks it against invariants, or
+// DefaultInvariants when none are given. It returns every violation found,
+// ordered by invariant.
+func (p *Policy) Verify(invariants ...Invariant) []Violation {
+	if len(invariants) == 0 {
+		invariants = DefaultInvariants()
+	}
+	e := p.Enumerate()
+	var violations []Violation
+	for _, inv := range invariants {
+		for _, v := range inv.Check(e) {
+			v.Invariant = inv.Name
+			violations = append(violations, v)
+		}
+	}
+	return violations
+}
@@ -0,0 +1,89 @@
+package state_transform
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestVerifyDefaultPolicy(t *testing.T) {
+	if violations := DefaultPolicy().Verify(); len(violations) != 0 {
+		t.Fatalf("default policy violates invariants: %v", violations)
+	}
+}
+
+// move puts action on the allow or deny list of subject in state.
+type move struct {
+	subject, state, action string
+	allow                  bool
+}
+
+// defaultPolicyWith returns the default policy with moves applied.
+func defaultPolicyWith(t *testing.T, moves ...move) *Policy {
+	t.Helper()
+	data, err := json.Marshal(DefaultPolicy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Subjects map[string]map[string]map[string][]string `json:"subjects"`
+		Roles    json.RawMessage                           `json:"roles"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range moves {
+		cell := file.Subjects[m.subject][m.state]
+		from, to := "deny", "allow"
+		if !m.allow {
+			from, to = to, from
+		}
+		i := slices.Index(cell[from], m.action)
+		if i < 0 {
+			t.Fatalf("%s %s: %s is not in %s", m.subject, m.state, m.action, from)
+		}
+		cell[from] = slices.Delete(cell[from], i, i+1)
+		cell[to] = append(cell[to], m.action)
+	}
+	data, _ = json.Marshal(file)
+	p, err := ParsePolicy(data)
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	return p
+}
+
+func TestVerifyFindsCounterexamples(t *testing.T) {
+	p := defaultPolicyWith(t,
+		move{"grant:executor", "banned", "exec", true},
+		move{"developer", "invalid", "delete", true},
+		move{"admin", "deleted", "restore", false},
+	)
+
+	got := make(map[string][]string)
+	for _, v := range p.Verify() {
+		got[v.Invariant] = append(got[v.Invariant], v.Case.String())
+	}
+	if want := "executor grantee without roles may exec in state banned"; !slices.Contains(got["banned-not-executable"], want) {
+		t.Fatalf("expected %q among %v", want, got["banned-not-executable"])
+	}
+	if slices.Contains(got["banned-not-executable"], "creator without roles may exec in state banned") {
+		t.Fatal("owners must not be reported")
+	}
+	// Everyone inheriting developer can now delete from invalid.
+	for _, want := range []string{"non-creator developer may delete in state invalid", "reader grantee admin may delete in state invalid"} {
+		if !slices.Contains(got["invalid-exits-by-develop"], want) {
+			t.Fatalf("expected %q among %v", want, got["invalid-exits-by-develop"])
+		}
+	}
+	if want := []string{"non-creator admin may not restore in state deleted"}; !slices.Equal(got["admin-covers-creator"], want) {
+		t.Fatalf("expected %v, got %v", want, got["admin-covers-creator"])
+	}
+
+	custom := Invariant{Name: "viewers-never-modify", Check: forEachCase(func(c Case) bool {
+		return !c.Allowed || c.Profile != (Profile{Role: "viewer"}) || c.Action != DatasetActionModify
+	})}
+	if violations := p.Verify(custom); len(violations) != 0 {
+		t.Fatalf("unexpected violations %v", violations)
+	}
+}